@@ -0,0 +1,331 @@
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Transition : a trigger pinned to an actual instant on the calendar
+// Schedules are defined on the wall clock, but are run on real instants - the 2 are not the same on days the clock is shifted for daylight saving
+type Transition struct {
+	At      time.Time
+	Trigger Trigger
+	// Closes : when true the schedule has no effect after this transition till the next one
+	// patch schedules close with their higher trigger, primary schedules never close
+	Closes bool
+}
+
+const (
+	// searchHorizon : how far back or ahead we look for the transitions of a schedule in one go
+	searchHorizon = 8 * 24 * time.Hour
+	// maxHorizon : beyond this if there are no transitions, there are none at all
+	// schedules that are restricted to dates are not looked for beyond a year
+	maxHorizon = 370 * 24 * time.Hour
+	dateFormat = "2006-01-02"
+)
+
+// Weekdays : mask of the days of the week, bit n set for time.Weekday(n)
+type Weekdays uint8
+
+// AllDays : every day of the week, this is the default for schedules
+const AllDays Weekdays = 0x7f
+
+var weekdayNames = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// weekdayFromName : SUN, MON .. or the full names of the days, case does not matter
+func weekdayFromName(name string) (time.Weekday, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for i, wd := range weekdayNames {
+		if len(name) >= 3 && strings.HasPrefix(name, wd) && strings.HasPrefix(strings.ToUpper(time.Weekday(i).String()), name) {
+			return time.Weekday(i), nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("%s is not a day of the week", name)
+}
+
+// ParseWeekdays : days of the week from names like MON, TUE or ranges like MON-FRI, ranges can wrap around the week as in FRI-MON
+// No names at all is every day of the week
+func ParseWeekdays(names []string) (Weekdays, error) {
+	if len(names) == 0 {
+		return AllDays, nil
+	}
+	var result Weekdays
+	for _, name := range names {
+		ends := strings.Split(name, "-")
+		if len(ends) > 2 {
+			return 0, fmt.Errorf("%s is not a valid range of days", name)
+		}
+		first, err := weekdayFromName(ends[0])
+		if err != nil {
+			return 0, err
+		}
+		last := first
+		if len(ends) == 2 {
+			if last, err = weekdayFromName(ends[1]); err != nil {
+				return 0, err
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			result |= 1 << uint(day)
+			if day == last {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// Has : true if the day of the week is in the mask
+func (wd Weekdays) Has(day time.Weekday) bool {
+	return wd&(1<<uint(day)) != 0
+}
+
+func (wd Weekdays) String() string {
+	if wd&AllDays == AllDays {
+		return "ALL"
+	}
+	days := []string{}
+	for i, name := range weekdayNames {
+		if wd.Has(time.Weekday(i)) {
+			days = append(days, name)
+		}
+	}
+	return strings.Join(days, ",")
+}
+
+// Calendar : restricts the days on which a schedule is in effect
+// Dates are calendar dates in the zone of the schedule, zero From or Until leaves that end open
+type Calendar struct {
+	Days  Weekdays
+	From  time.Time
+	Until time.Time
+	// Except : holidays on which the schedule does not run
+	Except Holidays
+	// Only : when not empty, the schedule runs only on these holidays - substitute schedules for holidays
+	Only Holidays
+}
+
+// EveryDay : calendar of schedules that are not restricted in any way
+var EveryDay = Calendar{Days: AllDays}
+
+// NewCalendar : calendar from names of the days and from/until dates as 2006-01-02, empty dates leave the range open
+func NewCalendar(days []string, from, until string) (Calendar, error) {
+	cal := Calendar{}
+	var err error
+	if cal.Days, err = ParseWeekdays(days); err != nil {
+		return cal, err
+	}
+	if from != "" {
+		if cal.From, err = time.Parse(dateFormat, from); err != nil {
+			return cal, fmt.Errorf("invalid from date %s, expected as %s", from, dateFormat)
+		}
+	}
+	if until != "" {
+		if cal.Until, err = time.Parse(dateFormat, until); err != nil {
+			return cal, fmt.Errorf("invalid until date %s, expected as %s", until, dateFormat)
+		}
+	}
+	if cal.Days&AllDays == 0 {
+		return cal, fmt.Errorf("calendar has to have atleast one day of the week")
+	}
+	if !cal.From.IsZero() && !cal.Until.IsZero() && cal.Until.Before(cal.From) {
+		return cal, fmt.Errorf("until date %s is before the from date %s", until, from)
+	}
+	return cal, nil
+}
+
+// Active : true if the calendar date is one of the days the schedule is in effect
+// date is as given out by dateOf
+func (cal Calendar) Active(date time.Time) bool {
+	if !cal.From.IsZero() && date.Before(cal.From) {
+		return false
+	}
+	if !cal.Until.IsZero() && date.After(cal.Until) {
+		return false
+	}
+	if len(cal.Only) > 0 && !cal.Only.On(date) {
+		return false
+	}
+	if cal.Except.On(date) {
+		return false
+	}
+	return cal.Days.Has(date.Weekday())
+}
+
+// Overlaps : true if there is atleast one date on which both the calendars are in effect
+func (cal Calendar) Overlaps(other Calendar) bool {
+	if excludes(cal, other) || excludes(other, cal) {
+		return false
+	}
+	from, until := cal.From, cal.Until
+	if from.IsZero() || (!other.From.IsZero() && other.From.After(from)) {
+		from = other.From
+	}
+	if until.IsZero() || (!other.Until.IsZero() && other.Until.Before(until)) {
+		until = other.Until
+	}
+	if !from.IsZero() && !until.IsZero() {
+		if until.Before(from) {
+			return false
+		}
+		if until.Sub(from) < 7*24*time.Hour {
+			// short enough for the days of the week to matter
+			for date := from; !date.After(until); date = date.AddDate(0, 0, 1) {
+				if cal.Active(date) && other.Active(date) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return cal.Days&other.Days != 0
+}
+
+// excludes : true if the calendar runs only on holidays the other one does not run on
+func excludes(cal, other Calendar) bool {
+	if len(cal.Only) == 0 {
+		return false
+	}
+	for _, h := range cal.Only {
+		if !other.Except.Has(h) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cal Calendar) String() string {
+	result := cal.Days.String()
+	if !cal.From.IsZero() {
+		result = fmt.Sprintf("%s from %s", result, cal.From.Format(dateFormat))
+	}
+	if !cal.Until.IsZero() {
+		result = fmt.Sprintf("%s until %s", result, cal.Until.Format(dateFormat))
+	}
+	if len(cal.Only) > 0 {
+		result = fmt.Sprintf("%s only on %v", result, cal.Only)
+	}
+	if len(cal.Except) > 0 {
+		result = fmt.Sprintf("%s except %v", result, cal.Except)
+	}
+	return result
+}
+
+// dateOf : calendar date of the time in the zone given, as midnight UTC
+// date arithmetic is done in UTC since in there every day is 24 hours
+func dateOf(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// forEachDate : calls back for each calendar date in the zone from the date of from till the date of to, both inclusive
+func forEachDate(from, to time.Time, loc *time.Location, callback func(date time.Time)) {
+	last := dateOf(to, loc)
+	for date := dateOf(from, loc); !date.After(last); date = date.AddDate(0, 0, 1) {
+		callback(date)
+	}
+}
+
+// wallClock : the instant on the date given when the wall clock in the zone reads secs since midnight
+// On days the clock springs forward, a wall clock time that is skipped falls on the next valid instant - the moment of the shift
+// On days the clock falls back, a wall clock time that occurs twice falls on its first occurrence
+func wallClock(date time.Time, secs int, loc *time.Location) time.Time {
+	y, m, d := date.Date()
+	naive := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Add(time.Duration(secs) * time.Second)
+	// offsets of the zone well before and well after the wall clock time
+	_, offBefore := naive.Add(-24 * time.Hour).In(loc).Zone()
+	_, offAfter := naive.Add(24 * time.Hour).In(loc).Zone()
+	first := naive.Add(-time.Duration(offBefore) * time.Second)
+	second := naive.Add(-time.Duration(offAfter) * time.Second)
+	if second.Before(first) {
+		first, second = second, first
+	}
+	for _, candidate := range []time.Time{first, second} {
+		cy, cm, cd := candidate.In(loc).Date()
+		ch, cmin, csec := candidate.In(loc).Clock()
+		if time.Date(cy, cm, cd, ch, cmin, csec, 0, time.UTC).Equal(naive) {
+			return candidate.In(loc)
+		}
+	}
+	// The wall clock time does not exist, the shift happens somewhere between the 2 candidates
+	lo, hi := first, second
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+		if _, off := mid.In(loc).Zone(); off == offBefore {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi.In(loc)
+}
+
+// inWindow : filters and sorts the transitions to only those from (inclusive) to (exclusive)
+func inWindow(trans []Transition, from, to time.Time) []Transition {
+	result := []Transition{}
+	for _, tr := range trans {
+		if !tr.At.Before(from) && tr.At.Before(to) {
+			result = append(result, tr)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].At.Before(result[j].At) })
+	return result
+}
+
+// lastTransition : the latest transition of the schedule at or before t
+// looks back a few days at a time, so that days the schedule is not in effect are skipped
+func lastTransition(sch Schedule, t time.Time) (Transition, bool) {
+	to := t.Add(time.Nanosecond)
+	for back := time.Duration(0); back < maxHorizon; back += searchHorizon {
+		trans := sch.Transitions(to.Add(-back-searchHorizon), to.Add(-back))
+		if len(trans) > 0 {
+			return trans[len(trans)-1], true
+		}
+	}
+	return Transition{}, false
+}
+
+// nextTransition : the earliest transition of the schedule strictly after t
+// looks ahead a few days at a time, so that days the schedule is not in effect are skipped
+func nextTransition(sch Schedule, t time.Time) (Transition, bool) {
+	from := t.Add(time.Nanosecond)
+	for ahead := time.Duration(0); ahead < maxHorizon; ahead += searchHorizon {
+		trans := sch.Transitions(from.Add(ahead), from.Add(ahead+searchHorizon))
+		if len(trans) > 0 {
+			return trans[0], true
+		}
+	}
+	return Transition{}, false
+}
+
+// ceilSeconds : whole seconds in the duration, rounded up so that sleeping for it never wakes up early
+func ceilSeconds(d time.Duration) int {
+	secs := int(d / time.Second)
+	if d%time.Second > 0 {
+		secs++
+	}
+	return secs
+}
+
+// toTask : near and far triggers with pre and post sleep worked out from the transitions of the schedule
+// when within the effect of the schedule, the last transition is applied now, and the next one after the post sleep
+// when beyond the effect of the schedule, pre sleep till the next transition and the post sleep till the one after
+// Delay is added to the pre sleep, since with Apply and Loop each schedule runs on its own with nothing to resolve priorities
+// the delayed one is sent a second or so after the ones it wins over at the same instant, the engine and StateAt do not need it
+func toTask(sch Schedule, now time.Time) (Trigger, Trigger, int, int) {
+	pre := sch.Delay()
+	next, ok := nextTransition(sch, now)
+	if !ok {
+		return nil, nil, pre, 0
+	}
+	if prev, ok := lastTransition(sch, now); ok && !prev.Closes {
+		return prev.Trigger, next.Trigger, pre, ceilSeconds(next.At.Sub(now))
+	}
+	after, ok := nextTransition(sch, next.At)
+	if !ok {
+		return nil, nil, pre, 0
+	}
+	return next.Trigger, after.Trigger, pre + ceilSeconds(next.At.Sub(now)), ceilSeconds(after.At.Sub(next.At))
+}
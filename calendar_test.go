@@ -0,0 +1,104 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWallClockDST : wall clock times that are skipped or repeated when the clocks shift
+func TestWallClockDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	assert.Nil(t, err)
+	springs := time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC)
+	falls := time.Date(2021, 11, 7, 0, 0, 0, 0, time.UTC)
+	// 02:30 AM does not exist on the day clocks spring forward, it fires at the shift - 03:00 AM EDT
+	assert.Equal(t, time.Date(2021, 3, 14, 7, 0, 0, 0, time.UTC), wallClock(springs, 2*3600+1800, ny).UTC())
+	// 01:30 AM occurs twice on the day clocks fall back, it fires on the first - 01:30 AM EDT
+	assert.Equal(t, time.Date(2021, 11, 7, 5, 30, 0, 0, time.UTC), wallClock(falls, 3600+1800, ny).UTC())
+	// any other time is just what it reads
+	assert.Equal(t, time.Date(2021, 3, 14, 22, 30, 0, 0, time.UTC), wallClock(springs, 18*3600+1800, ny).UTC())
+	// and in zones without daylight saving nothing is special
+	ist, _ := time.LoadLocation("Asia/Kolkata")
+	assert.Equal(t, time.Date(2021, 3, 14, 1, 0, 0, 0, time.UTC), wallClock(springs, 6*3600+1800, ist).UTC())
+}
+
+// TestToTaskDST : sleep durations over days that are 23 or 25 hours long
+func TestToTaskDST(t *testing.T) {
+	primary := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1"}, Primary: true, TZ: "America/New_York"},
+		{ON: "01:30 AM", OFF: "02:30 AM", IDs: []string{"IN2"}, Primary: false, TZ: "America/New_York"},
+		{ON: "02:05 AM", OFF: "02:45 AM", IDs: []string{"IN3"}, Primary: false, TZ: "America/New_York"},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, primary.ToSchedules(&scheds))
+	ny := scheds[0].Location()
+
+	// 08:00 PM to 06:30 AM is 10.5 hours on the wall clock but only 9.5 hours when the clock springs forward that night
+	nr, fr, _, post := scheds[0].ToTaskAt(time.Date(2021, 3, 13, 20, 0, 0, 0, ny))
+	assert.Equal(t, 18*3600+1800, nr.At())
+	assert.Equal(t, 6*3600+1800, fr.At())
+	assert.Equal(t, 9*3600+1800, post)
+	// and 11.5 hours when the clock falls back
+	_, _, _, post = scheds[0].ToTaskAt(time.Date(2021, 11, 6, 20, 0, 0, 0, ny))
+	assert.Equal(t, 11*3600+1800, post)
+
+	// 01:45 AM the second time around : the patch opened on the first 01:30 AM and is not opened again
+	second := time.Date(2021, 11, 7, 6, 45, 0, 0, time.UTC)
+	nr, _, pre, post := scheds[1].ToTaskAt(second)
+	assert.Equal(t, 3600+1800, nr.At())
+	assert.Equal(t, scheds[1].Delay(), pre, "Patch is in effect, there should not be any pre sleep")
+	assert.Equal(t, 45*60, post)
+	trans := scheds[1].Transitions(time.Date(2021, 11, 7, 0, 0, 0, 0, ny), time.Date(2021, 11, 8, 0, 0, 0, 0, ny))
+	assert.Equal(t, 2, len(trans), "Patch was expected to open and close only once on the day clocks fall back")
+
+	// when the clock springs forward 02:30 AM is 03:00 AM, and the patch is in effect only for half an hour
+	trans = scheds[1].Transitions(time.Date(2021, 3, 14, 0, 0, 0, 0, ny), time.Date(2021, 3, 15, 0, 0, 0, 0, ny))
+	if assert.Equal(t, 2, len(trans)) {
+		assert.Equal(t, 30*time.Minute, trans[1].At.Sub(trans[0].At))
+	}
+	// while a patch that is entirely in the skipped hour does not open at all
+	trans = scheds[2].Transitions(time.Date(2021, 3, 14, 0, 0, 0, 0, ny), time.Date(2021, 3, 15, 0, 0, 0, 0, ny))
+	assert.Equal(t, 0, len(trans), "Patch squeezed out by the shift was not expected to open")
+}
+
+// TestWeekdaySchedules : schedules in effect only on some days of the week or between dates
+func TestWeekdaySchedules(t *testing.T) {
+	days, err := ParseWeekdays([]string{"fri-mon", "Wednesday"})
+	assert.Nil(t, err)
+	assert.Equal(t, "SUN,MON,WED,FRI,SAT", days.String())
+	_, err = ParseWeekdays([]string{"MON-FUN"})
+	assert.NotNil(t, err, "Was expecting an error for a day that does not exist")
+
+	office := SliceOfJSONRelayState{
+		{ON: "07:00 AM", OFF: "07:00 PM", IDs: []string{"IN1"}, Primary: true, TZ: "UTC", Days: []string{"MON-FRI"}},
+		{ON: "09:00 AM", OFF: "01:00 PM", IDs: []string{"IN1"}, Primary: true, TZ: "UTC", Days: []string{"SAT", "SUN"}},
+		{ON: "06:00 PM", OFF: "08:00 PM", IDs: []string{"IN2"}, Primary: false, TZ: "UTC", From: "2021-08-10", Until: "2021-08-12"},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, office.ToSchedules(&scheds))
+	assert.Equal(t, 0, scheds[1].Conflicts(), "Weekday and weekend schedules were not expected to conflict")
+
+	// Friday 08:00 PM the lights go OFF and stay OFF thru the weekend for the weekday schedule
+	friday := time.Date(2021, 8, 6, 20, 0, 0, 0, time.UTC)
+	nr, fr, _, post := scheds[0].ToTaskAt(friday)
+	assert.Equal(t, 19*3600, nr.At())
+	assert.Equal(t, 7*3600, fr.At())
+	assert.Equal(t, 2*86400+11*3600, post, "Weekday schedule should sleep till Monday morning")
+	// while the weekend one takes over on Saturday
+	_, _, _, post = scheds[1].ToTaskAt(friday)
+	assert.Equal(t, 13*3600, post, "Weekend schedule should sleep till Saturday morning")
+	// patch in effect only from the 10th, sleeps till then
+	_, _, pre, _ := scheds[2].ToTaskAt(friday)
+	assert.Equal(t, 3*86400+22*3600+scheds[2].Delay(), pre)
+	// and after the 12th it never runs again
+	nr, fr, _, _ = scheds[2].ToTaskAt(time.Date(2021, 8, 12, 21, 0, 0, 0, time.UTC))
+	assert.Nil(t, nr)
+	assert.Nil(t, fr)
+
+	bad := SliceOfJSONRelayState{
+		{ON: "06:00 PM", OFF: "08:00 PM", IDs: []string{"IN2"}, From: "2021-08-12", Until: "2021-08-10"},
+	}
+	assert.NotNil(t, bad.ToSchedules(&scheds), "Was expecting an error for until before from")
+}
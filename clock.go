@@ -0,0 +1,168 @@
+package scheduling
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock : source of time for schedules, tasks and loops
+// Everything in this package that needs to know the current time or has to sleep goes thru a clock
+// so that a whole day of schedules can be exercised in tests without waiting for the day to pass
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer : a stoppable one shot timer obtained from a Clock
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// RealClock : clock backed by the system time, this is what Apply and Loop use by default
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (rt realTimer) C() <-chan time.Time { return rt.Timer.C }
+
+// FakeClock : a clock that moves only when asked to
+// Timers and sleeps registered on the fake clock fire when the clock is advanced past their deadline
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+type fakeTimer struct {
+	clk   *FakeClock
+	until time.Time
+	ch    chan time.Time
+}
+
+// NewFakeClock : makes a fake clock that starts at the given time
+func NewFakeClock(start time.Time) *FakeClock {
+	fc := &FakeClock{now: start}
+	fc.cond = sync.NewCond(&fc.mu)
+	return fc
+}
+
+// Now : current time as per the fake clock
+func (fc *FakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+// NewTimer : timer that fires when the clock is advanced by d or more
+func (fc *FakeClock) NewTimer(d time.Duration) Timer {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	ft := &fakeTimer{clk: fc, until: fc.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		ft.ch <- fc.now
+		return ft
+	}
+	fc.waiters = append(fc.waiters, ft)
+	fc.cond.Broadcast()
+	return ft
+}
+
+// After : same as time.After but on the fake clock
+func (fc *FakeClock) After(d time.Duration) <-chan time.Time {
+	return fc.NewTimer(d).C()
+}
+
+// Sleep : blocks till the clock is advanced by d
+func (fc *FakeClock) Sleep(d time.Duration) {
+	<-fc.After(d)
+}
+
+// Waiters : count of timers that are yet to fire
+func (fc *FakeClock) Waiters() int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return len(fc.waiters)
+}
+
+// BlockUntil : blocks the caller till there are atleast n timers waiting on the clock
+// Use this before advancing so that goroutines under test have had a chance to start waiting
+func (fc *FakeClock) BlockUntil(n int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for len(fc.waiters) < n {
+		fc.cond.Wait()
+	}
+}
+
+// Advance : moves the clock ahead by d, firing all the timers that fall due in order of their deadlines
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.advanceTo(fc.now.Add(d))
+}
+
+// AdvanceToNext : moves the clock to the earliest pending timer and fires it
+// returns the duration by which the clock moved, 0 if there weren't any timers waiting
+func (fc *FakeClock) AdvanceToNext() time.Duration {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if len(fc.waiters) == 0 {
+		return 0
+	}
+	sort.SliceStable(fc.waiters, func(i, j int) bool { return fc.waiters[i].until.Before(fc.waiters[j].until) })
+	then := fc.now
+	if fc.waiters[0].until.After(fc.now) {
+		fc.advanceTo(fc.waiters[0].until)
+	} else {
+		fc.advanceTo(fc.now)
+	}
+	return fc.now.Sub(then)
+}
+
+// advanceTo : expects the lock to be held
+func (fc *FakeClock) advanceTo(t time.Time) {
+	sort.SliceStable(fc.waiters, func(i, j int) bool { return fc.waiters[i].until.Before(fc.waiters[j].until) })
+	pending := []*fakeTimer{}
+	for _, ft := range fc.waiters {
+		if ft.until.After(t) {
+			pending = append(pending, ft)
+			continue
+		}
+		fc.now = ft.until
+		ft.ch <- ft.until
+	}
+	fc.waiters = pending
+	fc.now = t
+}
+
+func (ft *fakeTimer) C() <-chan time.Time {
+	return ft.ch
+}
+
+// Stop : prevents the timer from firing, false if the timer has already fired or was stopped
+func (ft *fakeTimer) Stop() bool {
+	fc := ft.clk
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for i, w := range fc.waiters {
+		if w == ft {
+			fc.waiters = append(fc.waiters[:i], fc.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFakeClock : timers on the fake clock fire only when advanced and in order of their deadlines
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2021, 8, 1, 18, 0, 0, 0, time.UTC)
+	fc := NewFakeClock(start)
+	late, early := fc.After(2*time.Hour), fc.After(1*time.Hour)
+	stopped := fc.NewTimer(30 * time.Minute)
+	assert.Equal(t, 3, fc.Waiters(), "Was expecting 3 timers on the clock")
+	assert.True(t, stopped.Stop(), "Was expecting a pending timer to stop")
+	assert.False(t, stopped.Stop(), "Timer once stopped cannot be stopped again")
+
+	fc.Advance(90 * time.Minute)
+	select {
+	case tm := <-early:
+		assert.Equal(t, start.Add(1*time.Hour), tm, "Timer should fire with its own deadline")
+	default:
+		t.Error("Was expecting the 1 hour timer to have fired")
+	}
+	select {
+	case <-late:
+		t.Error("2 hour timer should not have fired at 90 minutes")
+	default:
+	}
+	assert.Equal(t, 30*time.Minute, fc.AdvanceToNext(), "Next timer was due in 30 minutes")
+	assert.Equal(t, start.Add(2*time.Hour), fc.Now())
+	assert.Equal(t, 0, fc.Waiters())
+
+	// A routine sleeping on the clock is let go only when the clock moves
+	woke := make(chan interface{})
+	go func() {
+		fc.Sleep(24 * time.Hour)
+		close(woke)
+	}()
+	fc.BlockUntil(1)
+	fc.Advance(24 * time.Hour)
+	<-woke
+}
@@ -19,3 +19,17 @@ func (cmpsl ComparableSlice) Intersection(other ComparableSlice) (int, int, int)
 	}
 	return comm, len(cmpsl) - comm, len(other) - comm
 }
+
+// Common : items that are in both the slices, in the order of cmpsl
+func (cmpsl ComparableSlice) Common(other ComparableSlice) ComparableSlice {
+	result := ComparableSlice{}
+	for _, item := range cmpsl {
+		for _, oitem := range other {
+			if item == oitem {
+				result = append(result, item)
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,119 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Kinds of conflicts between 2 schedules
+const (
+	// ConflictPrimaries : 2 primary schedules in effect on the same days, there can be only one
+	ConflictPrimaries = "primary-vs-primary"
+	// ConflictSharedRelays : 2 primary schedules in effect on the same days that also drive the same relays, all day long
+	ConflictSharedRelays = "shared-relays"
+	// ConflictPrimaryPatch : patch schedule that straddles a trigger of the primary, rather than being inside or outside of it
+	ConflictPrimaryPatch = "primary-vs-patch"
+	// ConflictPatches : patch schedules that overlap in time and share relays
+	ConflictPatches = "overlapping-patches"
+	// ConflictPulse : pulse on relays that another schedule holds at the time, or that another pulse is pulsing
+	ConflictPulse = "pulse-on-held-relays"
+)
+
+// Conflict : why a schedule is in conflict with another one before it, the schedule in conflict is the one neglected
+type Conflict struct {
+	Kind     string
+	Schedule Schedule
+	With     Schedule
+	// Relays : relays common to both the schedules, could be none for the conflicts with a primary
+	Relays ComparableSlice
+	// From, To : seconds since midnight when both the schedules are in effect
+	From, To int
+}
+
+// newConflict : conflict of the later schedule with the earlier one
+func newConflict(earlier, later Schedule) Conflict {
+	_, ePrimary := earlier.(*primarySched)
+	_, lPrimary := later.(*primarySched)
+	c := Conflict{Kind: ConflictPatches, Schedule: later, With: earlier}
+	switch {
+	case ePrimary && lPrimary:
+		c.Kind = ConflictPrimaries
+	case ePrimary || lPrimary:
+		c.Kind = ConflictPrimaryPatch
+	}
+	eLw, _ := earlier.Triggers()
+	lLw, _ := later.Triggers()
+	c.Relays = eLw.RelayIDs().Common(lLw.RelayIDs())
+	if c.Kind == ConflictPrimaries && len(c.Relays) > 0 {
+		c.Kind = ConflictSharedRelays
+	}
+	if pulseClash(earlier, later) {
+		// window is that of the pulse, or of the earlier one for 2 pulses
+		pulse := later
+		if _, ok := earlier.(*pulseSchedule); ok {
+			pulse = earlier
+		}
+		c.Kind = ConflictPulse
+		c.From, c.To = arcOf(pulse)
+		c.To += c.From
+		return c
+	}
+	// window is from the start that is within the other schedule, till the end that is
+	es, el := arcOf(earlier)
+	ls, ll := arcOf(later)
+	within := func(start, length, t int) bool { return t == start || inArc(start, length, t) }
+	switch {
+	case within(ls, ll, es):
+		c.From = es
+	case within(es, el, ls):
+		c.From = ls
+	default:
+		// primary schedules are circular, and are in effect all day
+		c.From, c.To = 0, 86399
+		return c
+	}
+	c.To = (ls + ll) % 86400
+	if end := (es + el) % 86400; inArc(ls, ll, end) {
+		c.To = end
+	}
+	return c
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s conflicts with %s (%s) on %v between %s and %s", c.Schedule, c.With, c.Kind, c.Relays, TmStrFromUnixSecs(c.From), TmStrFromUnixSecs(c.To))
+}
+
+// MarshalJSON : schedules and times as strings, for API clients
+func (c Conflict) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Kind     string   `json:"kind"`
+		Schedule string   `json:"schedule"`
+		With     string   `json:"with"`
+		Relays   []string `json:"relays"`
+		From     TimeStr  `json:"from"`
+		To       TimeStr  `json:"to"`
+	}{c.Kind, fmt.Sprintf("%s", c.Schedule), fmt.Sprintf("%s", c.With), c.Relays, TmStrFromUnixSecs(c.From), TmStrFromUnixSecs(c.To)})
+}
+
+// ConflictReport : all the conflicts amongst a set of schedules
+type ConflictReport []Conflict
+
+// ConflictsIn : report of the conflicts amongst the schedules, as flagged when they were read
+func ConflictsIn(scheds []Schedule) ConflictReport {
+	result := ConflictReport{}
+	for _, s := range scheds {
+		result = append(result, s.Clashes()...)
+	}
+	return result
+}
+
+// Involving : conflicts the schedule is in, either as the one neglected or the one it clashes with
+func (cr ConflictReport) Involving(sch Schedule) ConflictReport {
+	result := ConflictReport{}
+	for _, c := range cr {
+		if c.Schedule == sch || c.With == sch {
+			result = append(result, c)
+		}
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConflictReport : each conflict says with which schedule, of what kind, on which relays and when
+func TestConflictReport(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, Primary: true},
+		{ON: "07:00 PM", OFF: "07:00 AM", IDs: []string{"IN3"}, Primary: true},
+		{ON: "06:00 PM", OFF: "07:00 PM", IDs: []string{"IN1"}},
+		{ON: "08:00 PM", OFF: "09:00 PM", IDs: []string{"IN4", "IN3"}},
+		{ON: "08:30 PM", OFF: "10:00 PM", IDs: []string{"IN3"}},
+		{ON: "10:30 PM", OFF: "11:00 PM", IDs: []string{"IN3"}},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	report := ConflictsIn(scheds)
+	for _, c := range report {
+		t.Log(c)
+	}
+	for _, s := range scheds {
+		assert.Equal(t, s.Conflicts(), len(s.Clashes()), "Every conflict counted should have been explained")
+	}
+
+	primaries := report.Involving(scheds[1])
+	assert.Equal(t, 1, len(primaries))
+	assert.Equal(t, ConflictPrimaries, primaries[0].Kind)
+	assert.True(t, scheds[0] == primaries[0].With)
+	assert.Equal(t, 0, len(primaries[0].Relays))
+
+	straddles := scheds[2].Clashes()
+	assert.Equal(t, 1, len(straddles))
+	assert.Equal(t, ConflictPrimaryPatch, straddles[0].Kind)
+	assert.Equal(t, ComparableSlice{"IN1"}, straddles[0].Relays)
+	assert.Equal(t, 18*3600, straddles[0].From)
+	assert.Equal(t, 18*3600+30*60, straddles[0].To)
+
+	patches := scheds[4].Clashes()
+	assert.Equal(t, 1, len(patches))
+	assert.Equal(t, ConflictPatches, patches[0].Kind)
+	assert.True(t, scheds[3] == patches[0].With)
+	assert.Equal(t, ComparableSlice{"IN3"}, patches[0].Relays)
+	assert.Equal(t, 0, len(scheds[5].Clashes()))
+
+	// primaries on the same relays are more than just 2 primaries
+	jrs = SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, Primary: true},
+		{ON: "07:00 PM", OFF: "07:00 AM", IDs: []string{"IN2", "IN3"}, Primary: true},
+	}
+	shared := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&shared))
+	assert.Equal(t, 1, len(shared[1].Clashes()))
+	assert.Equal(t, ConflictSharedRelays, shared[1].Clashes()[0].Kind)
+	assert.Equal(t, ComparableSlice{"IN2"}, shared[1].Clashes()[0].Relays)
+
+	byt, err := json.Marshal(patches[0])
+	assert.Nil(t, err)
+	assert.Equal(t, `{"kind":"overlapping-patches","schedule":"08:30 PM - 10:00 PM [IN3] ","with":"08:00 PM - 09:00 PM [IN4 IN3] ","relays":["IN3"],"from":"08:30 PM","to":"09:00 PM"}`, string(byt))
+}
@@ -0,0 +1,143 @@
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ApplyContext : applies the schedule for one cycle pre>state>post>state on the clock given, and returns when done
+// nil when the cycle is complete, the error of the context when its cancelled before that, and any other error applying the schedule
+// Nothing is sent once the context is done, so send can be closed safely after ApplyContext returns
+func ApplyContext(ctx context.Context, sch Schedule, clk Clock, send chan []byte) error {
+	if sch == nil {
+		return fmt.Errorf("Schedule/Apply: Null schedule, cannot apply")
+	}
+	if clk == nil {
+		clk = RealClock
+	}
+	nr, fr, pre, post := sch.ToTaskAt(clk.Now())
+	if nr == nil || fr == nil {
+		return fmt.Errorf("Schedule/Apply: %s has no upcoming transitions, cannot apply", sch)
+	}
+	log.Debugf("Near: %s Far: %s Pre: %d Post: %d\n", nr, fr, pre, post)
+	if err := sleepContext(ctx, clk, time.Duration(pre)*time.Second); err != nil {
+		return err
+	}
+	if err := sendContext(ctx, send, nr); err != nil {
+		return err
+	}
+	// a second extra, so that the far trigger is applied in the next slot as with Apply
+	if err := sleepContext(ctx, clk, pulseAfter(nr, post)); err != nil {
+		return err
+	}
+	return sendContext(ctx, send, fr)
+}
+
+// LoopContext : applies the schedule cycle after cycle till the context is done, or the schedule expires
+// nil when the schedule expires, in which case an event is sent on events (or logged if events is nil)
+// the error of the context when its cancelled, and any other error that stops the schedule from being applied
+func LoopContext(ctx context.Context, sch Schedule, clk Clock, send chan []byte, events chan Event) error {
+	if clk == nil {
+		clk = RealClock
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if sch != nil && expiredAt(sch, clk.Now()) {
+			ev := Event{Kind: EventExpired, Schedule: fmt.Sprintf("%s", sch), At: clk.Now()}
+			if events == nil {
+				log.Infof("Loop: %s", ev)
+				return nil
+			}
+			select {
+			case events <- ev:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err := ApplyContext(ctx, sch, clk, send); err != nil {
+			return err
+		}
+		if completedRun(sch, clk.Now()) {
+			sch.AddRun()
+		}
+	}
+}
+
+// sleepContext : sleeps on the clock for the duration, unless the context is done before that
+func sleepContext(ctx context.Context, clk Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := clk.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sendContext : sends the state of the trigger, unless the context is done before it could be sent
+func sendContext(ctx context.Context, send chan []byte, trg Trigger) error {
+	byt, err := json.Marshal(trg)
+	if err != nil {
+		return fmt.Errorf("Schedule/Apply: Failed to marshall trigger data - %s", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if send == nil {
+		log.Debugf("TCP: %s", string(byt))
+		return nil
+	}
+	select {
+	case send <- byt:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Group : schedules looped under one context, that can be waited upon to drain before shutting down
+// The zero value is ready to use
+type Group struct {
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+// Loop : starts looping the schedule in a goroutine of the group, see LoopContext
+func (g *Group) Loop(ctx context.Context, sch Schedule, clk Clock, send chan []byte, events chan Event) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		err := LoopContext(ctx, sch, clk, send, events)
+		if err != nil && err != context.Canceled && err != context.DeadlineExceeded {
+			log.Errorf("Loop: %s exited - %s", sch, err)
+			g.mu.Lock()
+			g.errs = append(g.errs, err)
+			g.mu.Unlock()
+		}
+	}()
+}
+
+// Wait : blocks till all the loops of the group have returned
+// gives out the first error any of them exited with, cancellation of the context is not an error
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.errs) > 0 {
+		return g.errs[0]
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package scheduling
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLoopContext : loops stop as soon as the context is cancelled, and the group drains before send is closed
+func TestLoopContext(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, TZ: "UTC", Primary: true},
+		{ON: "09:00 PM", OFF: "10:00 PM", IDs: []string{"IN3"}, TZ: "UTC"},
+		{ON: "07:00 PM", OFF: "08:00 PM", IDs: []string{"IN4"}, TZ: "UTC", Once: true},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	fc := NewFakeClock(time.Date(2021, 8, 1, 17, 0, 0, 0, time.UTC))
+	send, events := make(chan []byte), make(chan Event, 10)
+	msgs := collectSends(send)
+
+	// one cycle of the patch, pre sleep till 09:00 PM and then an hour
+	err := make(chan error)
+	go func() { err <- ApplyContext(context.Background(), scheds[1], fc, send) }()
+	for done := false; !done; {
+		select {
+		case e := <-err:
+			assert.Nil(t, e)
+			done = true
+		case <-time.After(10 * time.Millisecond):
+			fc.AdvanceToNext()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	group := &Group{}
+	for _, s := range scheds {
+		group.Loop(ctx, s, fc, send, events)
+	}
+	// the once patch expires after 08:00 PM, while the others keep looping
+	for expired := false; !expired; {
+		select {
+		case ev := <-events:
+			assert.Equal(t, EventExpired, ev.Kind)
+			assert.Equal(t, time.Date(2021, 8, 2, 20, 0, 2, 0, time.UTC), ev.At)
+			expired = true
+		case <-time.After(10 * time.Millisecond):
+			fc.AdvanceToNext()
+		}
+	}
+	fc.BlockUntil(2)
+	cancel()
+	assert.Nil(t, group.Wait(), "Cancellation is not an error")
+	assert.Equal(t, 0, fc.Waiters(), "Loops should not leave timers behind")
+	sent := msgs()
+	close(send)
+	// 2 for the patch applied, 5 from the primary over its cycles till 08:00 PM the next day, 2 for the once patch
+	assert.Equal(t, 9, len(sent))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, ApplyContext(ctx, scheds[0], fc, nil))
+	assert.NotNil(t, ApplyContext(context.Background(), nil, fc, nil))
+}
@@ -0,0 +1,295 @@
+package scheduling
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronExpr : standard cron expression with 5 fields - minute hour day-of-month month day-of-week
+// or with 6 fields where the leading one is for seconds
+// Each field can be * or ? , a value, a range 6-18, a list 1,15 or a step */15 6-18/2, months and days of the week can also be named JAN, MON
+type CronExpr struct {
+	src                                   string
+	second, minute, hour, dom, month, dow uint64
+	// when both days of the month and week are restricted, either of them matching is enough
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	min, max int
+	names    []string
+}
+
+var (
+	cronSeconds = cronField{0, 59, nil}
+	cronMinutes = cronField{0, 59, nil}
+	cronHours   = cronField{0, 23, nil}
+	cronDoms    = cronField{1, 31, nil}
+	cronMonths  = cronField{1, 12, []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}}
+	cronDows    = cronField{0, 7, weekdayNames}
+)
+
+// cronSearchLimit : Next gives up if there isn't any firing within these many years, as for 30th of February
+const cronSearchLimit = 5
+
+// IsCron : tells apart cron expressions from plain clock times
+func IsCron(expr string) bool {
+	n := len(strings.Fields(expr))
+	return n == 5 || n == 6
+}
+
+// ParseCron : reads up a cron expression, errors out describing the field that is invalid
+func ParseCron(expr string) (*CronExpr, error) {
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron expression %q should have 5 or 6 fields, has %d", expr, len(fields))
+	}
+	ce := &CronExpr{src: expr}
+	var err error
+	specs := []struct {
+		name  string
+		field cronField
+		bits  *uint64
+	}{
+		{"seconds", cronSeconds, &ce.second},
+		{"minutes", cronMinutes, &ce.minute},
+		{"hours", cronHours, &ce.hour},
+		{"day of month", cronDoms, &ce.dom},
+		{"month", cronMonths, &ce.month},
+		{"day of week", cronDows, &ce.dow},
+	}
+	for i, spec := range specs {
+		if *spec.bits, err = spec.field.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("cron expression %q, invalid %s: %s", expr, spec.name, err)
+		}
+	}
+	if ce.dow&(1<<7) != 0 {
+		// 7 is also sunday
+		ce.dow |= 1
+	}
+	ce.domStar = fields[3] == "*" || fields[3] == "?"
+	ce.dowStar = fields[5] == "*" || fields[5] == "?"
+	return ce, nil
+}
+
+func (cf cronField) value(s string) (int, error) {
+	for i, name := range cf.names {
+		if strings.EqualFold(s, name) {
+			return i + cf.min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if v < cf.min || v > cf.max {
+		return 0, fmt.Errorf("%d is out of range %d-%d", v, cf.min, cf.max)
+	}
+	return v, nil
+}
+
+// parse : bits set for all the values the field matches
+func (cf cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("%q is not a valid step", part[i+1:])
+			}
+			part = part[:i]
+		}
+		lo, hi := cf.min, cf.max
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			ends := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = cf.value(ends[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = cf.value(ends[1]); err != nil {
+				return 0, err
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("range %q is backwards", part)
+			}
+		default:
+			v, err := cf.value(part)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if step == 1 {
+				// a plain value, while a value with a step runs till the end of the range
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (ce *CronExpr) String() string {
+	return ce.src
+}
+
+func (ce *CronExpr) dayMatches(t time.Time) bool {
+	domOk := ce.dom&(1<<uint(t.Day())) != 0
+	dowOk := ce.dow&(1<<uint(t.Weekday())) != 0
+	if ce.domStar || ce.dowStar {
+		return domOk && dowOk
+	}
+	return domOk || dowOk
+}
+
+// Next : the first instant strictly after the time given when the expression fires, in the location of the time given
+// zero time if the expression does not fire within the next few years
+func (ce *CronExpr) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Second).Add(time.Second)
+	limit := t.AddDate(cronSearchLimit, 0, 0)
+	for t.Before(limit) {
+		y, mon, d := t.Date()
+		h, min, sec := t.Clock()
+		if ce.month&(1<<uint(mon)) == 0 {
+			t = time.Date(y, mon+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !ce.dayMatches(t) {
+			t = time.Date(y, mon, d+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if ce.hour&(1<<uint(h)) == 0 {
+			t = nextWallClock(t, time.Date(y, mon, d, h+1, 0, 0, 0, loc))
+			continue
+		}
+		if ce.minute&(1<<uint(min)) == 0 {
+			t = nextWallClock(t, time.Date(y, mon, d, h, min+1, 0, 0, loc))
+			continue
+		}
+		if ce.second&(1<<uint(sec)) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// nextWallClock : guards against the wall clock running backwards when clocks fall back
+func nextWallClock(current, next time.Time) time.Time {
+	if next.After(current) {
+		return next
+	}
+	return current.Add(time.Second)
+}
+
+// earliest, latest : first and last seconds of any day the expression fires at
+func (ce *CronExpr) earliest() int {
+	return lowestBit(ce.hour)*3600 + lowestBit(ce.minute)*60 + lowestBit(ce.second)
+}
+func (ce *CronExpr) latest() int {
+	return highestBit(ce.hour)*3600 + highestBit(ce.minute)*60 + highestBit(ce.second)
+}
+
+func lowestBit(bits uint64) int {
+	for i := 0; i < 64; i++ {
+		if bits&(1<<uint(i)) != 0 {
+			return i
+		}
+	}
+	return 0
+}
+func highestBit(bits uint64) int {
+	for i := 63; i >= 0; i-- {
+		if bits&(1<<uint(i)) != 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// cronTrg : trigger that fires whenever the cron expression does
+// At of a cron trigger is the earliest second of the day it can fire at, unless it closes a cron schedule when its the latest second
+type cronTrg struct {
+	*rlyStateTrg
+	expr *CronExpr
+}
+
+// NewCronTrg : trigger for relay states that fires on a cron expression
+func NewCronTrg(expr string, states ...*RelayState) (Trigger, error) {
+	ce, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	trg := NewTrg(ce.earliest(), states...).(*rlyStateTrg)
+	return &cronTrg{rlyStateTrg: trg, expr: ce}, nil
+}
+
+func (ct *cronTrg) String() string {
+	return fmt.Sprintf("cron(%s), %v", ct.expr, ct.RelayIDs())
+}
+
+// cronSchedule : patch schedule that opens whenever the ON expression fires and closes on the next firing of the OFF expression
+// so it can be in effect many times a day
+// For conflict detection its thought of as a patch from the earliest ON of the day to the latest OFF
+type cronSchedule struct {
+	*patchSchedule
+	on, off *cronTrg
+}
+
+func newCronSchedule(on, off *cronTrg) (Schedule, error) {
+	if !on.Intersects(off, true) {
+		return nil, fmt.Errorf("%s-%s Triggers for the schedule are not exactly intersecting", on, off)
+	}
+	// envelope of the schedule over any day
+	lower := &cronTrg{rlyStateTrg: &rlyStateTrg{at: on.expr.earliest(), rs: on.rs}, expr: on.expr}
+	higher := &cronTrg{rlyStateTrg: &rlyStateTrg{at: off.expr.latest(), rs: off.rs}, expr: off.expr}
+	if higher.at <= lower.at {
+		// closes only the day after, the envelope is the whole day
+		lower.at, higher.at = 0, 86399
+	}
+	cs := &cronSchedule{on: on, off: off}
+	cs.patchSchedule = &patchSchedule{primarySched: &primarySched{lower: lower, higher: higher, loc: time.Local, cal: EveryDay}}
+	return cs.own(cs), nil
+}
+
+func (cs *cronSchedule) String() string {
+	return fmt.Sprintf("cron(%s) - cron(%s) %v ", cs.on.expr, cs.off.expr, cs.on.RelayIDs())
+}
+
+// Transitions : every firing of the ON expression opens the schedule, and the next firing of OFF thereafter closes it
+// ON firings while the schedule is open are of no consequence
+func (cs *cronSchedule) Transitions(from, to time.Time) []Transition {
+	result := []Transition{}
+	t := from.Add(-24 * time.Hour).In(cs.loc)
+	for {
+		opens := cs.on.expr.Next(t)
+		if opens.IsZero() || !opens.Before(to) {
+			break
+		}
+		closes := cs.off.expr.Next(opens)
+		if closes.IsZero() {
+			break
+		}
+		if cs.cal.Active(dateOf(opens, cs.loc)) {
+			result = append(result,
+				Transition{At: opens, Trigger: cs.on},
+				Transition{At: closes, Trigger: cs.off, Closes: true},
+			)
+		}
+		// the schedule can open again at the same second it closes
+		t = closes.Add(-time.Second)
+	}
+	return inWindow(result, from, to)
+}
@@ -0,0 +1,71 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCronExpr : parsing and next firing of cron expressions
+func TestCronExpr(t *testing.T) {
+	ce, err := ParseCron("*/15 6-18 * * MON-FRI")
+	assert.Nil(t, err)
+	// Friday 06:50 PM the next firing is Monday 06:00 AM
+	friday := time.Date(2021, 8, 6, 18, 50, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2021, 8, 9, 6, 0, 0, 0, time.UTC), ce.Next(friday))
+	assert.Equal(t, time.Date(2021, 8, 6, 18, 45, 0, 0, time.UTC), ce.Next(friday.Add(-10*time.Minute)))
+
+	ce, err = ParseCron("30 0 12 1 JAN,jul *")
+	assert.Nil(t, err, "6 field expressions have seconds leading")
+	assert.Equal(t, time.Date(2022, 1, 1, 12, 0, 30, 0, time.UTC), ce.Next(friday))
+
+	// both days of month and week restricted, either matching is enough
+	ce, _ = ParseCron("0 9 13 * FRI")
+	assert.Equal(t, time.Date(2021, 8, 13, 9, 0, 0, 0, time.UTC), ce.Next(time.Date(2021, 8, 7, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2021, 9, 3, 9, 0, 0, 0, time.UTC), ce.Next(time.Date(2021, 8, 27, 10, 0, 0, 0, time.UTC)))
+
+	// never fires
+	ce, _ = ParseCron("0 0 30 FEB *")
+	assert.True(t, ce.Next(friday).IsZero())
+
+	for _, bad := range []string{"* * * *", "60 * * * *", "* 6-25 * * *", "*/0 * * * *", "* * * * MON-FUN", "* 18-6 * * *"} {
+		_, err := ParseCron(bad)
+		assert.NotNil(t, err, "Was expecting %q to be invalid", bad)
+	}
+}
+
+// TestCronSchedules : patches that recur many times a day and conflict detection over their envelope
+func TestCronSchedules(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:00 AM", OFF: "10:00 PM", IDs: []string{"IN1", "IN2"}, Primary: true, TZ: "UTC"},
+		// pump runs for 5 minutes every quarter of an hour, through the working hours
+		{ON: "*/15 6-18 * * MON-FRI", OFF: "5-59/15 6-18 * * MON-FRI", IDs: []string{"IN2"}, TZ: "UTC"},
+		{ON: "0 17 * * *", OFF: "0 20 * * *", IDs: []string{"IN2"}, TZ: "UTC"},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	pump := scheds[1]
+	assert.Equal(t, 6*3600, pump.Midpoint()-pump.Duration()/2, "Envelope should start at the earliest ON")
+	assert.Equal(t, 0, pump.Conflicts())
+	assert.Equal(t, 1, scheds[2].Conflicts(), "Cron patches overlapping on the same relay should conflict")
+
+	friday := time.Date(2021, 8, 6, 0, 0, 0, 0, time.UTC)
+	trans := pump.Transitions(friday, friday.Add(24*time.Hour))
+	assert.Equal(t, 2*4*13, len(trans), "4 times an hour from 6 till 18 hours")
+	nr, fr, pre, post := pump.ToTaskAt(friday.Add(6*time.Hour + 2*time.Minute))
+	assert.Equal(t, "cron(*/15 6-18 * * MON-FRI), [IN2]", nr.(*cronTrg).String())
+	assert.Equal(t, "cron(5-59/15 6-18 * * MON-FRI), [IN2]", fr.(*cronTrg).String())
+	assert.Equal(t, pump.Delay(), pre)
+	assert.Equal(t, 180, post)
+	_, _, pre, post = pump.ToTaskAt(friday.Add(6*time.Hour + 7*time.Minute))
+	assert.Equal(t, 8*60+pump.Delay(), pre)
+	assert.Equal(t, 300, post)
+	// builders give out the cron schedule as a whole, and its task is worked out from its own transitions
+	assert.IsType(t, &cronSchedule{}, pump.InLocation(time.UTC).WithPriority(PriorityBase).OnCalendar(pump.Calendar()))
+	_, _, pre, _ = pump.(*cronSchedule).primarySched.ToTaskAt(friday.Add(6*time.Hour + 7*time.Minute))
+	assert.Equal(t, 8*60+pump.Delay(), pre)
+
+	bad := SliceOfJSONRelayState{{ON: "*/15 6-18 * * *", OFF: "05:00 PM", IDs: []string{"IN2"}}}
+	assert.NotNil(t, bad.ToSchedules(&scheds), "Cron ON with a clock OFF should not make a schedule")
+}
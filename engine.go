@@ -0,0 +1,452 @@
+package scheduling
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// dispatch : one upcoming transition of a schedule in the queue of the engine
+type dispatch struct {
+	at    time.Time
+	sched Schedule
+	trans Transition
+	// boot : the state the schedule is in when added to the engine, its not a transition as such and is not counted as a run
+	boot bool
+	// retry : relays deferred by the protections or interlocks, to be resolved again, the states are for when no schedule is in effect on them by then
+	retry map[string]byte
+	seq   int
+	index int
+}
+
+// states : relays of the dispatch and their states, those deferred for a retry or else those of the transition
+func (d *dispatch) states() map[string]byte {
+	if d.retry != nil {
+		return d.retry
+	}
+	return d.trans.Trigger.States()
+}
+
+// dispatchQueue : min heap of dispatches, earliest first
+// dispatches at the same instant go in order of the priority of their schedules, and then in the order they were queued
+// Delay plays no part, the state of the relays is resolved over all the schedules at each dispatch as with StateAt
+// except that those closing a schedule go before those opening one, so relays are let go of before others are switched ON as interlocks need
+type dispatchQueue []*dispatch
+
+func (dq dispatchQueue) Len() int { return len(dq) }
+func (dq dispatchQueue) Less(i, j int) bool {
+	if !dq[i].at.Equal(dq[j].at) {
+		return dq[i].at.Before(dq[j].at)
+	}
+	if dq[i].trans.Closes != dq[j].trans.Closes {
+		return dq[i].trans.Closes
+	}
+	if dq[i].sched.Priority() != dq[j].sched.Priority() {
+		return dq[i].sched.Priority() < dq[j].sched.Priority()
+	}
+	return dq[i].seq < dq[j].seq
+}
+func (dq dispatchQueue) Swap(i, j int) {
+	dq[i], dq[j] = dq[j], dq[i]
+	dq[i].index, dq[j].index = i, j
+}
+func (dq *dispatchQueue) Push(x interface{}) {
+	d := x.(*dispatch)
+	d.index = len(*dq)
+	*dq = append(*dq, d)
+}
+func (dq *dispatchQueue) Pop() interface{} {
+	old := *dq
+	d := old[len(old)-1]
+	old[len(old)-1] = nil
+	d.index = -1
+	*dq = old[:len(old)-1]
+	return d
+}
+
+// Engine : runs any number of schedules from a single goroutine, as against a Loop per schedule
+// Upcoming transitions of all the schedules are kept in a priority queue and dispatched in a well defined order
+// with just one timer running for the earliest of them
+// At each transition the state of its relays is resolved over all the schedules on them as with StateAt
+// and only the relays whose state changes are sent
+type Engine struct {
+	clk    Clock
+	send   chan []byte
+	errx   chan error
+	events chan Event
+	mu     sync.Mutex
+	queue  dispatchQueue
+	// pending : the one dispatch each schedule in the engine has in the queue, nil while its being dispatched or has nothing more to dispatch
+	pending map[Schedule]*dispatch
+	// added : order in which the schedules were added, byRelay : schedules on each of the relays
+	added   map[Schedule]int
+	byRelay map[string][]Schedule
+	// sent : state of each relay as last sent, history : when each relay was switched
+	sent    map[string]byte
+	history map[string]*switching
+	locks   []Interlock
+	prots   []Protection
+	// deferred : the one retry each relay deferred by the protections or interlocks has in the queue
+	deferred map[string]*dispatch
+	// refused : ONs refused by the interlocks, deferred once the relay of the interlock that is ON goes OFF
+	refused map[string]*dispatch
+	seq     int
+	wake    chan struct{}
+}
+
+// NewEngine : engine that sends relay states on send, errors on errx and schedule events on events
+// any of the channels if nil, whats to be sent on it is just logged
+func NewEngine(clk Clock, send chan []byte, errx chan error, events chan Event) *Engine {
+	if clk == nil {
+		clk = RealClock
+	}
+	return &Engine{
+		clk:      clk,
+		send:     send,
+		errx:     errx,
+		events:   events,
+		pending:  map[Schedule]*dispatch{},
+		added:    map[Schedule]int{},
+		byRelay:  map[string][]Schedule{},
+		sent:     map[string]byte{},
+		history:  map[string]*switching{},
+		deferred: map[string]*dispatch{},
+		refused:  map[string]*dispatch{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Add : schedules are added to the engine, and the state each of them is in right now is applied first
+// Conflicts are not checked, add only those schedules that have none
+func (eng *Engine) Add(scheds ...Schedule) {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	now := eng.clk.Now()
+	for _, sch := range scheds {
+		if _, ok := eng.pending[sch]; ok || sch == nil {
+			continue
+		}
+		if sch.Expired(now) {
+			eng.notify(Event{Kind: EventExpired, Schedule: fmt.Sprintf("%s", sch), At: now})
+			continue
+		}
+		eng.seq++
+		eng.added[sch] = eng.seq
+		lw, _ := sch.Triggers()
+		for _, id := range lw.RelayIDs() {
+			eng.byRelay[id] = append(eng.byRelay[id], sch)
+		}
+		if prev, ok := lastTransition(sch, now); ok && !prev.Closes {
+			eng.push(&dispatch{at: now, sched: sch, trans: prev, boot: true})
+		} else {
+			eng.pushNext(sch, now)
+		}
+	}
+	eng.poke()
+}
+
+// Remove : schedule is taken out of the engine, false if it was not in the engine
+// if its in effect, its relays are resolved right away over the schedules left on them
+// those no other schedule is in effect on are left as the schedule would close them, or as they are for primaries
+func (eng *Engine) Remove(sch Schedule) bool {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	d, ok := eng.pending[sch]
+	if !ok {
+		return false
+	}
+	if d != nil {
+		heap.Remove(&eng.queue, d.index)
+	}
+	now := eng.clk.Now()
+	if last, in := lastTransition(sch, now); in && !last.Closes {
+		for id, state := range eng.leaves(sch, now) {
+			eng.deferTill(sch, id, state, now)
+		}
+	}
+	eng.forget(sch)
+	eng.poke()
+	return true
+}
+
+// leaves : states of the relays sent by the schedule once its out of the engine, as it would close them next
+// those of schedules that do not close are as last sent, expects the lock to be held
+func (eng *Engine) leaves(sch Schedule, now time.Time) map[string]byte {
+	result := map[string]byte{}
+	lw, _ := sch.Triggers()
+	for _, id := range lw.RelayIDs() {
+		if state, ok := eng.sent[id]; ok {
+			result[id] = state
+		}
+	}
+	if !closes(sch) {
+		return result
+	}
+	for _, trans := range sch.Transitions(now, now.Add(searchHorizon)) {
+		if trans.Closes {
+			// even if not yet marked as sent, as while its being dispatched
+			for id, state := range trans.Trigger.States() {
+				result[id] = state
+			}
+			break
+		}
+	}
+	return result
+}
+
+// forget : schedule is out of the engine, expects the lock to be held
+// relays it had deferred stay deferred, those belong to the relay and are resolved over the schedules left when due
+func (eng *Engine) forget(sch Schedule) {
+	delete(eng.pending, sch)
+	delete(eng.added, sch)
+	lw, _ := sch.Triggers()
+	for _, id := range lw.RelayIDs() {
+		on := []Schedule{}
+		for _, s := range eng.byRelay[id] {
+			if s != sch {
+				on = append(on, s)
+			}
+		}
+		eng.byRelay[id] = on
+	}
+}
+
+// resolve : state of each relay of the transition, resolved over all the schedules in the engine on those relays
+// relays no schedule is in effect on anymore after a patch closes, are left as the patch closes them
+// only the relays whose state is different from what was last sent are given out, expects the lock to be held
+// they are not marked as sent till they have gone out
+func (eng *Engine) resolve(d *dispatch) map[string]byte {
+	states := d.states()
+	on := []Schedule{}
+	for id := range states {
+		for _, sch := range eng.byRelay[id] {
+			on = append(on, sch)
+		}
+	}
+	sort.SliceStable(on, func(i, j int) bool { return eng.added[on[i]] < eng.added[on[j]] })
+	resolved := StateAt(on, d.at)
+	result := map[string]byte{}
+	for id, state := range states {
+		if status, ok := resolved[id]; ok {
+			state = status.State
+		}
+		if last, ok := eng.sent[id]; ok && last == state {
+			continue
+		}
+		result[id] = state
+	}
+	return result
+}
+
+// Schedules : all the schedules in the engine, in no particular order
+func (eng *Engine) Schedules() []Schedule {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	result := []Schedule{}
+	for sch := range eng.pending {
+		result = append(result, sch)
+	}
+	return result
+}
+
+// push : expects the lock to be held
+func (eng *Engine) push(d *dispatch) {
+	eng.seq++
+	d.seq = eng.seq
+	heap.Push(&eng.queue, d)
+	eng.pending[d.sched] = d
+}
+
+// pushNext : queues the next transition of the schedule after the time given, unless the schedule has expired
+// expects the lock to be held
+func (eng *Engine) pushNext(sch Schedule, after time.Time) {
+	next, ok := nextTransition(sch, after)
+	if ovs, held := sch.(*overrideSchedule); !ok && held && ovs.ov.Until.IsZero() {
+		// override till its released, stays in the engine with nothing queued
+		eng.pending[sch] = nil
+		return
+	}
+	if !ok || !fits(sch, next) {
+		eng.forget(sch)
+		eng.notify(Event{Kind: EventExpired, Schedule: fmt.Sprintf("%s", sch), At: after})
+		return
+	}
+	eng.push(&dispatch{at: next.At, sched: sch, trans: next})
+}
+
+// fits : true if the transition can be dispatched within the lifetime of the schedule
+// a transition that closes the schedule always can, so that relays are not left half way thru a cycle
+// while one that opens it can only if the schedule would close again before it expires
+func fits(sch Schedule, tr Transition) bool {
+	if tr.Closes {
+		return true
+	}
+	if sch.Expired(tr.At) {
+		return false
+	}
+	expires := sch.Lifetime().Expires
+	if expires.IsZero() {
+		return true
+	}
+	end := tr.At
+	if closes(sch) {
+		if cl, ok := nextTransition(sch, tr.At); ok {
+			end = cl.At
+		}
+	}
+	return end.Before(expires)
+}
+
+// poke : wakes up the engine to look at the queue again
+func (eng *Engine) poke() {
+	select {
+	case eng.wake <- struct{}{}:
+	default:
+	}
+}
+
+// notify : events are never waited upon, since the lock is held, those that the channel has no room for are logged
+func (eng *Engine) notify(ev Event) {
+	select {
+	case eng.events <- ev:
+	default:
+		log.Infof("Engine: %s", ev)
+	}
+}
+
+// Run : dispatches the transitions of all the schedules as they fall due, till stop is closed
+func (eng *Engine) Run(stop chan interface{}) {
+	for {
+		eng.mu.Lock()
+		var timer Timer
+		var due <-chan time.Time
+		if len(eng.queue) > 0 {
+			timer = eng.clk.NewTimer(eng.queue[0].at.Sub(eng.clk.Now()))
+			due = timer.C()
+		}
+		eng.mu.Unlock()
+		select {
+		case <-stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-eng.wake:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-due:
+			if !eng.dispatchDue(stop) {
+				return
+			}
+		}
+	}
+}
+
+// dispatchDue : sends all the transitions that are due, in order, queueing the next one for each of the schedules
+// false if stopped while sending
+func (eng *Engine) dispatchDue(stop chan interface{}) bool {
+	for {
+		eng.mu.Lock()
+		if len(eng.queue) == 0 || eng.queue[0].at.After(eng.clk.Now()) {
+			eng.mu.Unlock()
+			return true
+		}
+		d := heap.Pop(&eng.queue).(*dispatch)
+		if d.retry == nil {
+			eng.pending[d.sched] = nil
+		}
+		for id := range d.retry {
+			delete(eng.deferred, id)
+		}
+		for id := range d.states() {
+			// resolved again, if still against an interlock its refused again
+			delete(eng.refused, id)
+		}
+		now := eng.clk.Now()
+		states, refused := eng.interlock(d, eng.protect(d, eng.resolve(d), now), now)
+		eng.mu.Unlock()
+
+		for _, err := range refused {
+			if !eng.report(err, stop) {
+				return false
+			}
+		}
+		if !eng.deliver(states, stop) {
+			return false
+		}
+
+		eng.mu.Lock()
+		// only what has gone out is taken as sent
+		eng.mark(states, eng.clk.Now())
+		// unless a retry, removed, or queued again while being dispatched
+		if queued, ok := eng.pending[d.sched]; ok && queued == nil && d.retry == nil {
+			// a run is done when a patch closes, or for schedules that never close with every transition
+			if !d.boot && (d.trans.Closes || !closes(d.sched)) {
+				d.sched.AddRun()
+			}
+			eng.pushNext(d.sched, d.at)
+		}
+		eng.mu.Unlock()
+	}
+}
+
+// deferTill : queues the relay to be resolved again at the time, in place of any it already had queued
+// expects the lock to be held
+func (eng *Engine) deferTill(sch Schedule, id string, state byte, at time.Time) {
+	if queued, ok := eng.deferred[id]; ok {
+		heap.Remove(&eng.queue, queued.index)
+	}
+	d := &dispatch{at: at, sched: sch, retry: map[string]byte{id: state}}
+	eng.seq++
+	d.seq = eng.seq
+	heap.Push(&eng.queue, d)
+	eng.deferred[id] = d
+}
+
+// deliver : sends the states, if any, false if stopped while sending
+func (eng *Engine) deliver(states map[string]byte, stop chan interface{}) bool {
+	if len(states) == 0 {
+		// none of the relays change
+		return true
+	}
+	byt, err := json.Marshal(states)
+	if err != nil {
+		return eng.report(fmt.Errorf("Engine/Dispatch: Failed to marshall trigger data - %s", err), stop)
+	}
+	if eng.send == nil {
+		log.Debugf("TCP: %s", string(byt))
+		return true
+	}
+	select {
+	case eng.send <- byt:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// report : sends out the error, false if stopped while sending
+func (eng *Engine) report(err error, stop chan interface{}) bool {
+	if eng.errx == nil {
+		log.Error(err)
+		return true
+	}
+	select {
+	case eng.errx <- err:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// closes : true if the schedule ever goes out of effect, as patch schedules do
+func closes(sch Schedule) bool {
+	_, primary := sch.(*primarySched)
+	return !primary
+}
@@ -0,0 +1,62 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEngine : all the schedules run from one engine, their transitions go out in order of time and priority
+func TestEngine(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, TZ: "UTC", Primary: true},
+		{ON: "06:30 PM", OFF: "07:00 PM", IDs: []string{"IN3"}, TZ: "UTC"},
+		{ON: "04:30 PM", OFF: "06:00 PM", IDs: []string{"IN1"}, TZ: "UTC"},
+		{ON: "09:00 PM", OFF: "10:00 PM", IDs: []string{"IN4"}, TZ: "UTC", Once: true},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	// delay does not order the dispatches, the patch on IN3 at the same instant as the primary was queued before it
+	scheds[1].AddDelay(5)
+
+	start := time.Date(2021, 8, 1, 17, 0, 0, 0, time.UTC)
+	fc := NewFakeClock(start)
+	send, errx, events := make(chan []byte), make(chan error, 10), make(chan Event, 10)
+	msgs := collectSends(send)
+	eng := NewEngine(fc, send, errx, events)
+	eng.Add(scheds...)
+	assert.Equal(t, len(scheds), len(eng.Schedules()))
+	stop := make(chan interface{})
+	go eng.Run(stop)
+	advanceDay(fc, 1)
+	close(stop)
+	sent := msgs()
+	assert.Equal(t, 0, len(errx))
+
+	// primary is OFF and the patch at 04:30 PM is in effect when added, IN1 goes out as the patch wins
+	// the once patch goes out with an event after its one run
+	assert.Equal(t, []string{
+		`{"IN1":1,"IN2":0}`,
+		`{"IN1":0}`,
+		`{"IN3":1}`, `{"IN1":1,"IN2":1}`,
+		`{"IN3":0}`,
+		`{"IN4":1}`, `{"IN4":0}`,
+		`{"IN1":0,"IN2":0}`,
+		`{"IN1":1}`,
+	}, sent)
+	select {
+	case ev := <-events:
+		assert.Equal(t, EventExpired, ev.Kind)
+		assert.Equal(t, time.Date(2021, 8, 1, 22, 0, 0, 0, time.UTC), ev.At)
+	default:
+		t.Error("Was expecting the once schedule to expire")
+	}
+	assert.Equal(t, 1, scheds[3].Runs())
+	assert.Equal(t, 3, len(eng.Schedules()))
+
+	assert.True(t, eng.Remove(scheds[0]))
+	assert.False(t, eng.Remove(scheds[0]), "Schedule was already removed")
+	assert.False(t, eng.Remove(scheds[3]), "Expired schedule is not in the engine anymore")
+	assert.Equal(t, 2, len(eng.Schedules()))
+}
@@ -0,0 +1,91 @@
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RelayStatus : state a relay should be in at an instant, resolved over all the schedules, and why
+type RelayStatus struct {
+	ID    string
+	State byte
+	// Schedule : the schedule that won, its Trigger has been in effect Since
+	Schedule Schedule
+	Trigger  Trigger
+	Since    time.Time
+	// Overrides : other schedules in effect on the relay at the same instant, that lost to Schedule
+	Overrides []Schedule
+}
+
+func (rs RelayStatus) String() string {
+	state := "OFF"
+	switch {
+	case rs.State > 1:
+		state = fmt.Sprintf("at %d", rs.State)
+	case rs.State > 0:
+		state = "ON"
+	}
+	result := fmt.Sprintf("%s %s by %s since %s", rs.ID, state, rs.Schedule, rs.Since.Format(time.RFC3339))
+	if len(rs.Overrides) > 0 {
+		result = fmt.Sprintf("%s overriding %v", result, rs.Overrides)
+	}
+	return result
+}
+
+// candidate : schedule in effect on a relay, with the transition thats in effect
+type candidate struct {
+	sched Schedule
+	trans Transition
+	index int
+}
+
+// StateAt : resolves the state of every relay at the instant, the same way the engine applies schedules
+// Of all the schedules in effect on a relay, the one with the highest Priority wins
+// amongst those of the same priority the one whose trigger fired last, then a patch over a primary and then the last in the slice
+// Schedules with conflicts or those expired are left out since they are never run, relays no schedule is in effect on are not in the result
+func StateAt(scheds []Schedule, at time.Time) map[string]RelayStatus {
+	byRelay := map[string][]candidate{}
+	for i, sch := range scheds {
+		if sch == nil || sch.Conflicts() > 0 || sch.Expired(at) {
+			continue
+		}
+		trans, ok := lastTransition(sch, at)
+		if !ok || trans.Closes {
+			continue
+		}
+		for id := range trans.Trigger.States() {
+			byRelay[id] = append(byRelay[id], candidate{sched: sch, trans: trans, index: i})
+		}
+	}
+	result := map[string]RelayStatus{}
+	for id, cands := range byRelay {
+		sort.SliceStable(cands, func(i, j int) bool {
+			if cands[i].sched.Priority() != cands[j].sched.Priority() {
+				return cands[i].sched.Priority() < cands[j].sched.Priority()
+			}
+			if !cands[i].trans.At.Equal(cands[j].trans.At) {
+				return cands[i].trans.At.Before(cands[j].trans.At)
+			}
+			if closes(cands[i].sched) != closes(cands[j].sched) {
+				// patches win over primaries as they always have
+				return !closes(cands[i].sched)
+			}
+			return cands[i].index < cands[j].index
+		})
+		won := cands[len(cands)-1]
+		status := RelayStatus{
+			ID:        id,
+			State:     won.trans.Trigger.States()[id],
+			Schedule:  won.sched,
+			Trigger:   won.trans.Trigger,
+			Since:     won.trans.At,
+			Overrides: []Schedule{},
+		}
+		for _, c := range cands[:len(cands)-1] {
+			status.Overrides = append(status.Overrides, c.sched)
+		}
+		result[id] = status
+	}
+	return result
+}
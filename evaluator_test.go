@@ -0,0 +1,88 @@
+package scheduling
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStateAt : patches in effect win over the primary, and only while they are in effect
+func TestStateAt(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, TZ: "UTC", Primary: true},
+		{ON: "05:30 PM", OFF: "06:25 PM", IDs: []string{"IN1"}, TZ: "UTC"},
+		{ON: "07:30 PM", OFF: "08:30 PM", IDs: []string{"IN3"}, TZ: "UTC", Until: "2021-08-01"},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+
+	states := StateAt(scheds, time.Date(2021, 8, 1, 17, 40, 0, 0, time.UTC))
+	assert.Equal(t, 2, len(states), "IN3 is not in effect at 05:40 PM")
+	assert.Equal(t, byte(1), states["IN1"].State)
+	assert.True(t, scheds[1] == states["IN1"].Schedule, "Patch was expected to win over the primary")
+	assert.Equal(t, []Schedule{scheds[0]}, states["IN1"].Overrides)
+	assert.Equal(t, time.Date(2021, 8, 1, 17, 30, 0, 0, time.UTC), states["IN1"].Since)
+	assert.Equal(t, byte(0), states["IN2"].State)
+	assert.Equal(t, time.Date(2021, 8, 1, 6, 30, 0, 0, time.UTC), states["IN2"].Since)
+	t.Log(states["IN1"])
+
+	states = StateAt(scheds, time.Date(2021, 8, 1, 19, 40, 0, 0, time.UTC))
+	assert.Equal(t, 3, len(states))
+	assert.Equal(t, byte(1), states["IN1"].State)
+	assert.True(t, scheds[0] == states["IN1"].Schedule, "Patch has closed, primary was expected to win")
+	assert.Equal(t, 0, len(states["IN1"].Overrides))
+	assert.Equal(t, byte(1), states["IN3"].State)
+
+	// the day after, the patch on IN3 has run its dates
+	states = StateAt(scheds, time.Date(2021, 8, 2, 19, 40, 0, 0, time.UTC))
+	_, ok := states["IN3"]
+	assert.False(t, ok)
+	assert.Equal(t, byte(1), states["IN2"].State)
+
+	// a patch opening at the same instant the primary switches wins, wherever it is in the slice
+	jrs = SliceOfJSONRelayState{
+		{ON: "06:30 AM", OFF: "07:00 AM", IDs: []string{"IN2"}, TZ: "UTC"},
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, TZ: "UTC", Primary: true},
+	}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	assert.Equal(t, 0, scheds[1].Conflicts())
+	states = StateAt(scheds, time.Date(2021, 8, 1, 6, 40, 0, 0, time.UTC))
+	assert.True(t, scheds[0] == states["IN2"].Schedule)
+	assert.Equal(t, byte(1), states["IN2"].State)
+}
+
+// TestPriorities : schedules of higher priority win while in effect, and do not conflict with those of lower priority
+func TestPriorities(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, TZ: "UTC", Primary: true},
+		{ON: "05:00 PM", OFF: "07:00 PM", IDs: []string{"IN1"}, TZ: "UTC", Priority: PriorityFloor},
+		{ON: "05:30 PM", OFF: "06:00 PM", IDs: []string{"IN1"}, TZ: "UTC", Priority: PriorityMaintenance},
+		{ON: "06:45 PM", OFF: "07:30 PM", IDs: []string{"IN1"}, TZ: "UTC", Priority: PriorityFloor},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	assert.Equal(t, PriorityBase, scheds[0].Priority())
+	assert.Equal(t, PriorityMaintenance, scheds[2].Priority())
+	// only the 2 floor overrides clash, the rest are of different priorities
+	report := ConflictsIn(scheds)
+	assert.Equal(t, 1, len(report))
+	assert.True(t, scheds[3] == report[0].Schedule)
+
+	winner := func(hr, min int) Schedule {
+		return StateAt(scheds, time.Date(2021, 8, 1, hr, min, 0, 0, time.UTC))["IN1"].Schedule
+	}
+	assert.True(t, scheds[1] == winner(17, 15))
+	assert.True(t, scheds[2] == winner(17, 45), "Maintenance wins over the floor override")
+	assert.True(t, scheds[1] == winner(18, 45), "Floor override wins over the primary that turned ON later")
+	assert.True(t, scheds[0] == winner(19, 15))
+
+	// the floor override closing, IN1 stays ON as the primary has it ON by then
+	tl := CompileTimeline(scheds, time.Date(2021, 8, 1, 16, 0, 0, 0, time.UTC), time.Date(2021, 8, 1, 20, 0, 0, 0, time.UTC))
+	got := []string{}
+	for _, ev := range tl.ForRelay("IN1").Events {
+		got = append(got, fmt.Sprintf("%s=%d", ev.At.Format("15:04"), ev.State))
+	}
+	assert.Equal(t, []string{"16:00=0", "17:00=1", "17:30=1", "18:00=1", "19:00=1"}, got)
+}
@@ -0,0 +1,201 @@
+package scheduling
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Holiday : a date on which schedules for its relays are suppressed, and substitute schedules if any run instead
+type Holiday struct {
+	Name string
+	// Date : calendar date, only the month and the day matter when the holiday is yearly
+	Date   time.Time
+	Yearly bool
+	// IDs : relays the holiday applies to, empty for all the relays
+	IDs ComparableSlice
+}
+
+// On : true if the holiday falls on the calendar date (as given out by dateOf)
+func (h Holiday) On(date time.Time) bool {
+	if h.Yearly {
+		return h.Date.Month() == date.Month() && h.Date.Day() == date.Day()
+	}
+	return h.Date.Equal(date)
+}
+
+// Covers : true if the holiday applies to any of the relays
+// schedules cannot be split, so a holiday on any one relay of the schedule suppresses the schedule as a whole
+func (h Holiday) Covers(ids ComparableSlice) bool {
+	if len(h.IDs) == 0 {
+		return true
+	}
+	comm, _, _ := h.IDs.Intersection(ids)
+	return comm > 0
+}
+
+func (h Holiday) String() string {
+	if h.Yearly {
+		return fmt.Sprintf("%s(every %s)", h.Name, h.Date.Format("Jan 02"))
+	}
+	return fmt.Sprintf("%s(%s)", h.Name, h.Date.Format(dateFormat))
+}
+
+// Holidays : list of holidays, as read from the schedule file and/or an iCalendar file
+type Holidays []Holiday
+
+// On : true if any of the holidays falls on the calendar date
+func (hs Holidays) On(date time.Time) bool {
+	for _, h := range hs {
+		if h.On(date) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covering : only those holidays that apply to any of the relays
+func (hs Holidays) Covering(ids ComparableSlice) Holidays {
+	result := Holidays{}
+	for _, h := range hs {
+		if h.Covers(ids) {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+// Has : true if the same holiday is in the list
+func (hs Holidays) Has(holiday Holiday) bool {
+	for _, h := range hs {
+		if h.Name == holiday.Name && h.Yearly == holiday.Yearly && h.Date.Equal(holiday.Date) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseHolidayDate : 2006-01-02 for a holiday on a date, 01-02 for one that comes every year on that day
+func ParseHolidayDate(date string) (time.Time, bool, error) {
+	if t, err := time.Parse(dateFormat, date); err == nil {
+		return t, false, nil
+	}
+	// 2000 is a leap year, so that 29th of February can be yearly too
+	if t, err := time.Parse(dateFormat, "2000-"+date); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("invalid holiday date %s, expected as 2006-01-02 or 01-02 for every year", date)
+}
+
+// JSONHoliday : holiday as in the schedule file
+type JSONHoliday struct {
+	Name string `json:"name" bson:"name"`
+	// Date : 2006-01-02, or 01-02 for a holiday every year
+	Date string   `json:"date" bson:"date"`
+	IDs  []string `json:"ids,omitempty" bson:"ids,omitempty"`
+	// Schedules : run only on the holiday, in place of the ones suppressed
+	Schedules SliceOfJSONRelayState `json:"schedules,omitempty" bson:"schedules,omitempty"`
+}
+
+// ToHoliday : reads up the holiday from json
+func (jh *JSONHoliday) ToHoliday() (Holiday, error) {
+	date, yearly, err := ParseHolidayDate(jh.Date)
+	if err != nil {
+		return Holiday{}, fmt.Errorf("Failed to read holiday %s: %s", jh.Name, err)
+	}
+	return Holiday{Name: jh.Name, Date: date, Yearly: yearly, IDs: ComparableSlice(jh.IDs)}, nil
+}
+
+// ReadICalendar : holidays from the all day events of an iCalendar (.ics) file
+// events with a yearly RRULE are holidays every year, the holidays apply to all the relays
+// an event that ends after the day it starts on, as per its DTEND, is a holiday on each of the days till then
+// recurrences other than every year, and DURATION, cannot be read as holidays and are errors
+func ReadICalendar(file string) (Holidays, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// unfolding lines, continuation lines start with a space or a tab
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	result := Holidays{}
+	var event *Holiday
+	var until time.Time
+	for i, line := range lines {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		// property name can have parameters after a semicolon, DTSTART;VALUE=DATE
+		name, value := strings.ToUpper(strings.SplitN(line[:colon], ";", 2)[0]), line[colon+1:]
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event, until = &Holiday{}, time.Time{}
+		case event == nil:
+		case name == "SUMMARY":
+			event.Name = value
+		case name == "DTSTART":
+			if event.Date, err = icalDate(value); err != nil {
+				return nil, fmt.Errorf("%s line %d: invalid DTSTART %s", file, i+1, value)
+			}
+		case name == "DTEND":
+			end, err := icalDate(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: invalid DTEND %s", file, i+1, value)
+			}
+			// all day events end on the day after, while those with a time end on the day itself unless at midnight
+			if len(value) > 8 && !strings.HasPrefix(value[8:], "T000000") {
+				end = end.AddDate(0, 0, 1)
+			}
+			until = end
+		case name == "DURATION":
+			return nil, fmt.Errorf("%s line %d: DURATION is not supported for holidays, use DTEND", file, i+1)
+		case name == "RRULE":
+			for _, part := range strings.Split(strings.ToUpper(value), ";") {
+				if part != "FREQ=YEARLY" && part != "INTERVAL=1" {
+					return nil, fmt.Errorf("%s line %d: RRULE %s cannot be read as a holiday, only FREQ=YEARLY is supported", file, i+1, value)
+				}
+			}
+			event.Yearly = true
+		case name == "END" && value == "VEVENT":
+			if event.Date.IsZero() {
+				return nil, fmt.Errorf("%s line %d: event %s has no DTSTART", file, i+1, event.Name)
+			}
+			if until.IsZero() || !until.After(event.Date) {
+				until = event.Date.AddDate(0, 0, 1)
+			}
+			if until.Sub(event.Date) > 366*24*time.Hour {
+				return nil, fmt.Errorf("%s line %d: event %s is more than a year long", file, i+1, event.Name)
+			}
+			for date := event.Date; date.Before(until); date = date.AddDate(0, 0, 1) {
+				day := *event
+				day.Date = date
+				result = append(result, day)
+			}
+			event = nil
+		}
+	}
+	return result, nil
+}
+
+// icalDate : calendar date of a DTSTART or DTEND value, 20060102 or 20060102T150405Z
+func icalDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("%s is not a date", value)
+	}
+	return time.Parse("20060102", value[:8])
+}
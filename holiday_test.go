@@ -0,0 +1,76 @@
+package scheduling
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHolidays : schedules suppressed on holidays and substitutes running only on those
+func TestHolidays(t *testing.T) {
+	ical, err := ReadICalendar("test_holidays.ics")
+	assert.Nil(t, err)
+	if assert.Equal(t, 5, len(ical)) {
+		assert.Equal(t, "Republic day", ical[0].Name, "Folded lines should be read as one")
+		assert.True(t, ical[0].Yearly)
+		assert.False(t, ical[1].Yearly)
+		// DTEND is the day after the last day of the holiday
+		for i, d := range []int{12, 13, 14} {
+			assert.Equal(t, "Puja", ical[2+i].Name)
+			assert.Equal(t, time.Date(2021, 10, d, 0, 0, 0, 0, time.UTC), ical[2+i].Date)
+		}
+	}
+	dir, err := ioutil.TempDir("", "holidays")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, prop := range []string{"RRULE:FREQ=WEEKLY", "RRULE:FREQ=YEARLY;COUNT=3", "DURATION:P2D"} {
+		file := filepath.Join(dir, "unsupported.ics")
+		ics := "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART;VALUE=DATE:20211012\n" + prop + "\nSUMMARY:Unsupported\nEND:VEVENT\nEND:VCALENDAR\n"
+		assert.Nil(t, ioutil.WriteFile(file, []byte(ics), 0644))
+		_, err := ReadICalendar(file)
+		assert.NotNil(t, err, "Was expecting %s to be an error", prop)
+	}
+
+	scheds, err := ReadScheduleFile("test_sched5.json")
+	assert.Nil(t, err)
+	if !assert.Equal(t, 3, len(scheds)) {
+		return
+	}
+	primary, patch, diwali := scheds[0], scheds[1], scheds[2]
+	assert.Equal(t, 0, diwali.Conflicts(), "Substitute should not conflict with the schedule it substitutes")
+	day := func(y int, m time.Month, d int) (time.Time, time.Time) {
+		from := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		return from, from.Add(24 * time.Hour)
+	}
+	// on Diwali the primary is suppressed, it closes at the start of the day with the lights OFF and is back the morning after
+	onDiwali := primary.Transitions(day(2021, 11, 4))
+	if assert.Equal(t, 1, len(onDiwali)) {
+		assert.True(t, onDiwali[0].Closes)
+		assert.Equal(t, time.Date(2021, 11, 4, 0, 0, 0, 0, time.UTC), onDiwali[0].At)
+		assert.Equal(t, map[string]byte{"IN1": 0, "IN2": 0}, onDiwali[0].Trigger.States())
+	}
+	state := StateAt(scheds, time.Date(2021, 11, 4, 12, 0, 0, 0, time.UTC))
+	_, held := state["IN2"]
+	assert.False(t, held, "No schedule is in effect on IN2 thru the holiday")
+	assert.Equal(t, diwali, StateAt(scheds, time.Date(2021, 11, 4, 18, 0, 0, 0, time.UTC))["IN1"].Schedule)
+	nr, fr, pre, post := primary.ToTaskAt(time.Date(2021, 11, 4, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, 6*3600+1800, nr.At())
+	assert.Equal(t, 18*3600+1800, fr.At())
+	assert.Equal(t, 18*3600+1800, pre)
+	assert.Equal(t, 12*3600, post)
+	// patch on another relay is not affected
+	assert.Equal(t, 2, len(patch.Transitions(day(2021, 11, 4))))
+	// substitute runs only on Diwali
+	assert.Equal(t, 2, len(diwali.Transitions(day(2021, 11, 4))))
+	assert.Equal(t, 0, len(diwali.Transitions(day(2021, 11, 5))))
+	nr, _, _, _ = diwali.ToTaskAt(time.Date(2021, 11, 5, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, nr, "Substitute for a holiday on a date should never run again")
+	// holidays from iCalendar apply to all the relays, and yearly ones every year
+	assert.Equal(t, 1, len(primary.Transitions(day(2022, 1, 26))))
+	assert.Equal(t, 0, len(patch.Transitions(day(2021, 8, 15))))
+	assert.Equal(t, 2, len(patch.Transitions(day(2022, 8, 15))))
+}
@@ -0,0 +1,237 @@
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Interlock : relays of which at most one may be ON at a time, as for motor forward/reverse or star-delta starters
+// With a dead time, a relay of the group is not switched ON till that long after another of the group was switched OFF
+// Relays at any level above 0 are taken to be ON
+type Interlock struct {
+	IDs      []string
+	DeadTime time.Duration
+}
+
+// NewInterlock : interlock has to be on atleast 2 distinct relays
+func NewInterlock(deadTime time.Duration, ids ...string) (Interlock, error) {
+	if len(ids) < 2 {
+		return Interlock{}, fmt.Errorf("interlock has to be on atleast 2 relays")
+	}
+	if deadTime < 0 {
+		return Interlock{}, fmt.Errorf("%s dead time of an interlock cannot be negative", deadTime)
+	}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			return Interlock{}, fmt.Errorf("%s is more than once in the interlock", id)
+		}
+		seen[id] = true
+	}
+	return Interlock{IDs: append([]string{}, ids...), DeadTime: deadTime}, nil
+}
+
+func (il Interlock) String() string {
+	if il.DeadTime == 0 {
+		return fmt.Sprintf("interlock %v", il.IDs)
+	}
+	return fmt.Sprintf("interlock %v dead time %s", il.IDs, il.DeadTime)
+}
+
+// has : true if the relay is one of the interlock
+func (il Interlock) has(id string) bool {
+	for _, i := range il.IDs {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// InterlockViolation : relay that the schedules switch ON while another of its interlock is ON, or within the dead time of it going OFF
+type InterlockViolation struct {
+	Interlock Interlock
+	At        time.Time
+	Relay     string
+	Other     string
+	// Schedule : the one that switches the relay ON
+	Schedule string
+	// DeadTime : true if the other relay is OFF, but went OFF within the dead time
+	DeadTime bool
+}
+
+func (iv InterlockViolation) String() string {
+	if iv.DeadTime {
+		return fmt.Sprintf("%s %s ON by %s within %s of %s going OFF, %s", iv.At.Format(time.RFC3339), iv.Relay, iv.Schedule, iv.Interlock.DeadTime, iv.Other, iv.Interlock)
+	}
+	return fmt.Sprintf("%s %s ON by %s while %s is ON, %s", iv.At.Format(time.RFC3339), iv.Relay, iv.Schedule, iv.Other, iv.Interlock)
+}
+
+// CheckInterlocks : previews the schedules over the window as in CompileTimeline, and gives out every time a relay is switched ON against any of the interlocks
+func CheckInterlocks(scheds []Schedule, locks []Interlock, from, to time.Time) []InterlockViolation {
+	result := []InterlockViolation{}
+	if len(locks) == 0 {
+		return result
+	}
+	on := map[string]bool{}
+	offAt := map[string]time.Time{}
+	for _, ev := range CompileTimeline(scheds, from, to).Events {
+		if ev.State == 0 {
+			if on[ev.Relay] {
+				offAt[ev.Relay] = ev.At
+			}
+			on[ev.Relay] = false
+			continue
+		}
+		if on[ev.Relay] {
+			// only the level changes
+			continue
+		}
+		on[ev.Relay] = true
+		for _, il := range locks {
+			if !il.has(ev.Relay) {
+				continue
+			}
+			for _, other := range il.IDs {
+				if other == ev.Relay {
+					continue
+				}
+				iv := InterlockViolation{Interlock: il, At: ev.At, Relay: ev.Relay, Other: other, Schedule: ev.Schedule}
+				if on[other] {
+					result = append(result, iv)
+				} else if off, ok := offAt[other]; ok && ev.At.Sub(off) < il.DeadTime {
+					iv.DeadTime = true
+					result = append(result, iv)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// JSONInterlock : interlock as read from the schedule file, dead time as a duration, "2s"
+type JSONInterlock struct {
+	IDs      []string `json:"ids" bson:"ids"`
+	DeadTime string   `json:"dead_time,omitempty" bson:"dead_time,omitempty"`
+}
+
+// ToInterlock : interlock from the json, without a dead time its 0
+func (jil JSONInterlock) ToInterlock() (Interlock, error) {
+	var deadTime time.Duration
+	if jil.DeadTime != "" {
+		d, err := time.ParseDuration(jil.DeadTime)
+		if err != nil {
+			return Interlock{}, fmt.Errorf("Failed to read dead time for interlock: %s", err)
+		}
+		deadTime = d
+	}
+	return NewInterlock(deadTime, jil.IDs...)
+}
+
+// Interlock : rules the engine enforces before sending any relay state, these replace the ones before
+// A relay that would be ON together with another of its interlock is refused, and the error sent out
+// its resolved over the schedules again once the other relay goes OFF, after the dead time
+// ONs within the dead time of another relay of the interlock going OFF are deferred till its over, when the relay is resolved over the schedules again
+func (eng *Engine) Interlock(locks ...Interlock) {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	eng.locks = append([]Interlock{}, locks...)
+}
+
+// Interlocks : rules the engine enforces
+func (eng *Engine) Interlocks() []Interlock {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	return append([]Interlock{}, eng.locks...)
+}
+
+// interlock : states that can be sent right away, ONs within the dead time are deferred to when its over
+// ONs against the interlocks are left out, with an error for each of them, and deferred once the relay that is ON goes OFF
+// relays going OFF in the same states are taken to go OFF now, nothing is marked as sent, expects the lock to be held
+func (eng *Engine) interlock(d *dispatch, states map[string]byte, now time.Time) (map[string]byte, []error) {
+	if len(eng.locks) == 0 {
+		return states, nil
+	}
+	on, offAt := map[string]byte{}, map[string]time.Time{}
+	for id, state := range eng.sent {
+		on[id] = state
+	}
+	for id, sw := range eng.history {
+		offAt[id] = sw.offAt
+	}
+	result := map[string]byte{}
+	ids := []string{}
+	for id, state := range states {
+		if state > 0 {
+			ids = append(ids, id)
+			continue
+		}
+		if on[id] > 0 {
+			offAt[id] = now
+		}
+		on[id] = 0
+		result[id] = state
+	}
+	sort.Strings(ids)
+	refused := []error{}
+	for _, id := range ids {
+		ok, until := true, now
+		for _, il := range eng.locks {
+			if !il.has(id) {
+				continue
+			}
+			for _, other := range il.IDs {
+				if other == id {
+					continue
+				}
+				if on[other] > 0 {
+					refused = append(refused, fmt.Errorf("Engine/Interlock: refused %s ON while %s is ON, %s", id, other, il))
+					eng.refused[id] = &dispatch{sched: d.sched, retry: map[string]byte{id: states[id]}}
+					ok = false
+				} else if off := offAt[other]; !off.IsZero() && off.Add(il.DeadTime).After(until) {
+					until = off.Add(il.DeadTime)
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+		if until.After(now) {
+			eng.deferTill(d.sched, id, states[id], until)
+			continue
+		}
+		// the ones let thru first win over the rest of their interlock
+		on[id] = states[id]
+		result[id] = states[id]
+	}
+	return result, refused
+}
+
+// mark : states as sent, and recorded in the history of the relays, expects the lock to be held
+// ONs refused for a relay that goes OFF are deferred till the dead time after, to be resolved again
+func (eng *Engine) mark(states map[string]byte, now time.Time) {
+	for id, state := range states {
+		sw, ok := eng.history[id]
+		if !ok {
+			sw = &switching{}
+			eng.history[id] = sw
+		}
+		sw.record(state, now)
+		eng.sent[id] = state
+		if state > 0 {
+			continue
+		}
+		for _, il := range eng.locks {
+			if !il.has(id) {
+				continue
+			}
+			for _, other := range il.IDs {
+				if r, ok := eng.refused[other]; ok {
+					delete(eng.refused, other)
+					eng.deferTill(r.sched, other, r.retry[other], now.Add(il.DeadTime))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestInterlock : schedules that switch relays of an interlock ON together are caught when read, and the engine refuses or holds back such ONs
+func TestInterlock(t *testing.T) {
+	_, err := NewInterlock(0, "FWD")
+	assert.NotNil(t, err, "Interlock has to be on atleast 2 relays")
+	_, err = NewInterlock(0, "FWD", "FWD")
+	assert.NotNil(t, err)
+	_, err = JSONInterlock{IDs: []string{"FWD", "REV"}, DeadTime: "2 secs"}.ToInterlock()
+	assert.NotNil(t, err)
+	lock, err := JSONInterlock{IDs: []string{"FWD", "REV"}, DeadTime: "2m"}.ToInterlock()
+	assert.Nil(t, err)
+
+	from := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	check := func(revOn string) []InterlockViolation {
+		jrs := SliceOfJSONRelayState{
+			{ON: "08:00 AM", OFF: "09:00 AM", IDs: []string{"FWD"}, TZ: "UTC"},
+			{ON: revOn, OFF: "10:00 AM", IDs: []string{"REV"}, TZ: "UTC"},
+		}
+		scheds := []Schedule{}
+		assert.Nil(t, jrs.ToSchedules(&scheds))
+		return CheckInterlocks(scheds, []Interlock{lock}, from, from.AddDate(0, 0, 1))
+	}
+	violations := check("08:30 AM")
+	assert.Equal(t, 1, len(violations))
+	assert.Equal(t, "REV", violations[0].Relay)
+	assert.Equal(t, "FWD", violations[0].Other)
+	assert.False(t, violations[0].DeadTime)
+	assert.Equal(t, time.Date(2021, 8, 1, 8, 30, 0, 0, time.UTC), violations[0].At)
+	violations = check("09:01 AM")
+	assert.Equal(t, 1, len(violations))
+	assert.True(t, violations[0].DeadTime, "REV is ON within the dead time of FWD going OFF")
+	assert.Equal(t, 0, len(check("09:02 AM")))
+
+	sf := ScheduleFile{TZ: "UTC", Schedules: SliceOfJSONRelayState{
+		{ON: "08:00 AM", OFF: "09:00 AM", IDs: []string{"FWD"}},
+		{ON: "08:30 AM", OFF: "10:00 AM", IDs: []string{"REV"}},
+	}, Interlocks: []JSONInterlock{{IDs: []string{"FWD", "REV"}}}}
+	scheds := []Schedule{}
+	assert.NotNil(t, sf.ToSchedules(&scheds), "Schedules against the interlock are rejected when read")
+
+	// checked over the week from the instant given, REV runs against FWD only on the holiday
+	sf = ScheduleFile{TZ: "UTC", Schedules: SliceOfJSONRelayState{
+		{ON: "08:00 AM", OFF: "09:00 AM", IDs: []string{"FWD"}},
+	}, Holidays: []JSONHoliday{{Name: "Shutdown", Date: "2021-08-03", IDs: []string{"REV"}, Schedules: SliceOfJSONRelayState{
+		{ON: "08:30 AM", OFF: "10:00 AM", IDs: []string{"REV"}},
+	}}}, Interlocks: []JSONInterlock{{IDs: []string{"FWD", "REV"}}}}
+	assert.NotNil(t, sf.ToSchedulesAt(&scheds, time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)))
+	assert.Nil(t, sf.ToSchedulesAt(&scheds, time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)), "holiday is not in the week")
+	// schedules that conflict never run, and are not checked
+	sf = ScheduleFile{TZ: "UTC", Schedules: SliceOfJSONRelayState{
+		{ON: "08:00 AM", OFF: "09:00 AM", IDs: []string{"FWD"}},
+		{ON: "08:30 AM", OFF: "09:30 AM", IDs: []string{"FWD"}},
+		{ON: "09:15 AM", OFF: "10:00 AM", IDs: []string{"REV"}},
+	}, Interlocks: []JSONInterlock{{IDs: []string{"FWD", "REV"}}}}
+	assert.Nil(t, sf.ToSchedulesAt(&scheds, time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 3, len(scheds))
+	assert.Equal(t, 1, scheds[1].Conflicts(), "the FWD that REV is against conflicts")
+
+	// the engine defers REV for the dead time after FWD goes OFF, and refuses FWD while REV is ON
+	jrs := SliceOfJSONRelayState{
+		{ON: "08:00 AM", OFF: "09:00 AM", IDs: []string{"FWD"}, TZ: "UTC"},
+		{ON: "09:00 AM", OFF: "10:00 AM", IDs: []string{"REV"}, TZ: "UTC"},
+	}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	fc := NewFakeClock(time.Date(2021, 8, 1, 7, 0, 0, 0, time.UTC))
+	send, errx := make(chan []byte), make(chan error, 10)
+	msgs := collectSends(send)
+	eng := NewEngine(fc, send, errx, nil)
+	eng.Interlock(Interlock{IDs: []string{"FWD", "REV"}, DeadTime: 2 * time.Second})
+	assert.Equal(t, 1, len(eng.Interlocks()))
+	eng.Add(scheds...)
+	stop := make(chan interface{})
+	defer close(stop)
+	go eng.Run(stop)
+	fc.BlockUntil(1)
+	fc.Advance(time.Hour)
+	fc.BlockUntil(1)
+	fc.Advance(time.Hour)
+	// REV is deferred to when the dead time is over, not waited on, nor taken as sent before it is
+	fc.BlockUntil(1)
+	eng.mu.Lock()
+	assert.Equal(t, byte(0), eng.sent["REV"])
+	assert.Equal(t, fc.Now().Add(2*time.Second), eng.deferred["REV"].at)
+	eng.mu.Unlock()
+	fc.Advance(2 * time.Second)
+	fc.BlockUntil(1)
+	_, err = eng.OverrideFor(1, time.Minute, "FWD")
+	assert.Nil(t, err)
+	assert.NotNil(t, <-errx, "FWD cannot be ON while REV is")
+	assert.Equal(t, []string{`{"FWD":1}`, `{"FWD":0}`, `{"REV":1}`}, msgs())
+
+	// FWD refused while REV is ON is resolved again once REV goes OFF, and is ON for the rest of its patch
+	jrs = SliceOfJSONRelayState{
+		{ON: "09:00 AM", OFF: "10:00 AM", IDs: []string{"REV"}, TZ: "UTC"},
+		{ON: "09:30 AM", OFF: "10:30 AM", IDs: []string{"FWD"}, TZ: "UTC"},
+	}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	fc = NewFakeClock(time.Date(2021, 8, 1, 8, 0, 0, 0, time.UTC))
+	send = make(chan []byte)
+	eng = NewEngine(fc, send, errx, nil)
+	eng.Interlock(Interlock{IDs: []string{"FWD", "REV"}, DeadTime: 2 * time.Second})
+	eng.Add(scheds...)
+	stop2 := make(chan interface{})
+	defer close(stop2)
+	go eng.Run(stop2)
+	fc.BlockUntil(1)
+	fc.Advance(time.Hour)
+	assert.Equal(t, `{"REV":1}`, string(<-send))
+	fc.BlockUntil(1)
+	fc.Advance(30 * time.Minute)
+	assert.NotNil(t, <-errx, "FWD cannot be ON while REV is")
+	fc.BlockUntil(1)
+	fc.Advance(30 * time.Minute)
+	assert.Equal(t, `{"REV":0}`, string(<-send))
+	fc.BlockUntil(1)
+	fc.Advance(2 * time.Second)
+	assert.Equal(t, `{"FWD":1}`, string(<-send))
+	fc.BlockUntil(1)
+	fc.Advance(30 * time.Minute)
+	assert.Equal(t, `{"FWD":0}`, string(<-send))
+}
@@ -0,0 +1,97 @@
+package scheduling
+
+import (
+	"fmt"
+	"time"
+)
+
+// intervalSchedule : duty cycle within a window of the day, relays are ON for a while then OFF for a while, over and over
+// Its a sequence of all the cycles in the window that closes with the window, the last ON is cut short at the end of the window if need be
+// While the window is open the relays are held by the schedule even when OFF, and for conflict detection its one patch over the window
+type intervalSchedule struct {
+	*sequenceSchedule
+	on, off time.Duration
+}
+
+// NewIntervalSchedule : relays ON for the on duration and then OFF for the off duration, from the opens trigger till the closes trigger
+// opens has the ON states of the relays and closes the OFF ones, just as for a patch, cycles start afresh every day with opens
+// Durations are in whole seconds, the window cannot wrap past midnight
+func NewIntervalSchedule(opens, closes Trigger, on, off time.Duration) (Schedule, error) {
+	if opens == nil || closes == nil {
+		return nil, fmt.Errorf("triggers of an interval schedule cannot be nil")
+	}
+	for _, trg := range []Trigger{opens, closes} {
+		switch trg.(type) {
+		case *cronTrg, *solarTrg:
+			return nil, fmt.Errorf("%s window of an interval schedule can only be clock times", trg)
+		}
+	}
+	if !opens.Intersects(closes, true) || opens.Coincides(closes) {
+		return nil, fmt.Errorf("%s-%s Triggers for the schedule are either not exactly intersecting or are coinciding", opens, closes)
+	}
+	if closes.At() < opens.At() {
+		return nil, fmt.Errorf("%s-%s window of an interval schedule cannot wrap past midnight", opens, closes)
+	}
+	if on < time.Second || off < time.Second || on%time.Second != 0 || off%time.Second != 0 {
+		return nil, fmt.Errorf("%s on %s off, interval schedules cycle in whole seconds, of at least a second each", on, off)
+	}
+	onStates, offStates := []*RelayState{}, []*RelayState{}
+	for id, state := range opens.States() {
+		onStates = append(onStates, &RelayState{state, id})
+	}
+	for id, state := range closes.States() {
+		offStates = append(offStates, &RelayState{state, id})
+	}
+	steps := []Trigger{}
+	onSecs, period := int(on/time.Second), int((on+off)/time.Second)
+	for at := opens.At(); at < closes.At(); at += period {
+		stop := at + onSecs
+		if stop > closes.At() {
+			stop = closes.At()
+		}
+		steps = append(steps, NewTrg(at, onStates...), NewTrg(stop, offStates...))
+	}
+	if last := steps[len(steps)-1]; last.At() < closes.At() {
+		// window closes in the OFF of the last cycle, relays are held OFF till then
+		steps = append(steps, NewTrg(closes.At(), offStates...))
+	}
+	seq, err := NewSequenceSchedule(steps...)
+	if err != nil {
+		return nil, err
+	}
+	is := &intervalSchedule{sequenceSchedule: seq.(*sequenceSchedule), on: on, off: off}
+	return is.own(is), nil
+}
+
+func (is *intervalSchedule) String() string {
+	return fmt.Sprintf("%s - %s %v %s on %s off ", TmStrFromUnixSecs(is.lower.At()), TmStrFromUnixSecs(is.higher.At()), is.lower.RelayIDs(), is.on, is.off)
+}
+
+// JSONCycle : duty cycle of an interval schedule, durations as 10m or 1h30m
+type JSONCycle struct {
+	ON  string `json:"on" bson:"on"`
+	OFF string `json:"off" bson:"off"`
+}
+
+// interval : interval schedule that cycles between the ON and OFF times of the schedule
+func (jrs *JSONRelayState) interval(ons, offs []*RelayState, loc *time.Location) (Schedule, error) {
+	if jrs.Primary {
+		return nil, fmt.Errorf("Interval schedules can only be patch schedules, cannot be primary")
+	}
+	if IsCron(jrs.ON) || IsCron(jrs.OFF) {
+		return nil, fmt.Errorf("Interval schedules cannot be on cron expressions")
+	}
+	on, off, err := jrs.triggers(ons, offs, loc)
+	if err != nil {
+		return nil, err
+	}
+	onFor, err := time.ParseDuration(jrs.Cycle.ON)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read ON duration of the cycle for schedule: %s", err)
+	}
+	offFor, err := time.ParseDuration(jrs.Cycle.OFF)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read OFF duration of the cycle for schedule: %s", err)
+	}
+	return NewIntervalSchedule(on, off, onFor, offFor)
+}
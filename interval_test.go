@@ -0,0 +1,71 @@
+package scheduling
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestInterval : pump that runs 10 minutes every hour within a window, as one schedule
+func TestInterval(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "09:00 PM", OFF: "05:00 AM", IDs: []string{"IN1", "IN2"}, TZ: "UTC", Primary: true},
+		{ON: "06:00 AM", OFF: "08:00 PM", IDs: []string{"IN1"}, TZ: "UTC", Cycle: &JSONCycle{ON: "10m", OFF: "50m"}},
+		{ON: "12:15 PM", OFF: "08:30 PM", IDs: []string{"IN1"}, TZ: "UTC"},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	pump := scheds[1]
+	assert.Equal(t, "06:00 AM - 08:00 PM [IN1] 10m0s on 50m0s off ", fmt.Sprintf("%s", pump))
+	assert.Equal(t, 0, pump.Conflicts(), "Window is within the primary")
+
+	from := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	trans := pump.Transitions(from, from.Add(24*time.Hour))
+	assert.Equal(t, 29, len(trans), "14 cycles and the close of the window")
+	assert.Equal(t, time.Date(2021, 8, 1, 7, 0, 0, 0, time.UTC), trans[2].At)
+	assert.Equal(t, byte(1), trans[2].Trigger.States()["IN1"])
+	assert.Equal(t, time.Date(2021, 8, 1, 7, 10, 0, 0, time.UTC), trans[3].At)
+	assert.Equal(t, byte(0), trans[3].Trigger.States()["IN1"])
+	assert.False(t, trans[3].Closes)
+	assert.Equal(t, time.Date(2021, 8, 1, 20, 0, 0, 0, time.UTC), trans[28].At)
+	assert.True(t, trans[28].Closes)
+
+	nr, fr, _, post := pump.ToTaskAt(time.Date(2021, 8, 1, 6, 5, 0, 0, time.UTC))
+	assert.Equal(t, trans[0].Trigger, nr)
+	assert.Equal(t, trans[1].Trigger, fr)
+	assert.Equal(t, 300, post)
+
+	// OFF thru the cycle, the relays are still held by the schedule
+	states := StateAt(scheds, time.Date(2021, 8, 1, 6, 30, 0, 0, time.UTC))
+	assert.Equal(t, byte(0), states["IN1"].State)
+	assert.True(t, pump == states["IN1"].Schedule)
+	states = StateAt(scheds, time.Date(2021, 8, 1, 20, 30, 0, 0, time.UTC))
+	assert.True(t, scheds[0] == states["IN1"].Schedule)
+
+	// the patch overlaps the window, and not just a cycle of it
+	report := ConflictsIn(scheds)
+	assert.Equal(t, 1, len(report))
+	assert.True(t, pump == report[0].With)
+	assert.Equal(t, ConflictPatches, report[0].Kind)
+
+	// window ends 5 minutes into a cycle
+	sch, err := NewIntervalSchedule(NewTrg(3600, &RelayState{1, "IN1"}), NewTrg(3600*3+300, &RelayState{0, "IN1"}), 10*time.Minute, 50*time.Minute)
+	assert.Nil(t, err)
+	sch.InLocation(time.UTC)
+	trans = sch.Transitions(from, from.Add(24*time.Hour))
+	assert.Equal(t, 6, len(trans))
+	assert.Equal(t, time.Date(2021, 8, 1, 3, 5, 0, 0, time.UTC), trans[5].At)
+
+	bad := []JSONRelayState{
+		{ON: "06:00 AM", OFF: "08:00 PM", IDs: []string{"IN1"}, Cycle: &JSONCycle{ON: "0s", OFF: "50m"}},
+		{ON: "06:00 AM", OFF: "08:00 PM", IDs: []string{"IN1"}, Cycle: &JSONCycle{ON: "10", OFF: "50m"}},
+		{ON: "06:00 AM", OFF: "08:00 PM", IDs: []string{"IN1"}, Cycle: &JSONCycle{ON: "10m", OFF: "50m"}, Primary: true},
+		{ON: "08:00 PM", OFF: "06:00 AM", IDs: []string{"IN1"}, Cycle: &JSONCycle{ON: "10m", OFF: "50m"}},
+	}
+	for _, b := range bad {
+		_, err := b.ToSchedule()
+		assert.NotNil(t, err, "Was expecting an error for %v", b.Cycle)
+	}
+}
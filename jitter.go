@@ -0,0 +1,115 @@
+package scheduling
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+// jitterSchedule : patch whose triggers shift by a random offset within the window every day, so that lights look occupied while away
+// Offsets are drawn from the seed and the date, so the same seed gives the same times every time its asked for
+// For conflict detection the patch is widened by the window at both ends, so that it does not conflict on any day
+type jitterSchedule struct {
+	*patchSchedule
+	// opens, closes : the triggers as given, the embedded patch is on the widened ones
+	opens, closes Trigger
+	window        time.Duration
+	seed          int64
+}
+
+// NewJitterSchedule : patch from opens till closes, each of them shifted by upto the window either way everyday
+// The patch has to be longer than twice the window, so that it never closes before it opens
+func NewJitterSchedule(opens, closes Trigger, window time.Duration, seed int64) (Schedule, error) {
+	if opens == nil || closes == nil {
+		return nil, fmt.Errorf("triggers of a jitter schedule cannot be nil")
+	}
+	for _, trg := range []Trigger{opens, closes} {
+		switch trg.(type) {
+		case *cronTrg, *solarTrg:
+			return nil, fmt.Errorf("%s jitter can only be on clock times", trg)
+		}
+	}
+	secs := int(window / time.Second)
+	if secs < 1 {
+		return nil, fmt.Errorf("%s jitter window has to be at least a second", window)
+	}
+	given, err := NewPatchSchedule(opens, closes)
+	if err != nil {
+		return nil, err
+	}
+	if given.Duration() <= 2*secs || given.Duration()+2*secs >= 86400 {
+		return nil, fmt.Errorf("%s-%s patch has to be longer than twice the jitter window of %s, and shorter than the day when widened by it", opens, closes, window)
+	}
+	widened, err := NewPatchSchedule(NewTrg((opens.At()-secs+86400)%86400, relayStates(opens.RelayIDs(), opens.States())...), NewTrg((closes.At()+secs)%86400, relayStates(closes.RelayIDs(), closes.States())...))
+	if err != nil {
+		return nil, err
+	}
+	js := &jitterSchedule{patchSchedule: widened.(*patchSchedule), opens: opens, closes: closes, window: window, seed: seed}
+	return js.own(js), nil
+}
+
+func (js *jitterSchedule) String() string {
+	return fmt.Sprintf("%s - %s %v jitter %s ", TmStrFromUnixSecs(js.opens.At()), TmStrFromUnixSecs(js.closes.At()), js.opens.RelayIDs(), js.window)
+}
+
+// offset : shift of the trigger on the date in whole seconds, the same for the same seed, date and trigger
+func (js *jitterSchedule) offset(date time.Time, trg int) time.Duration {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%s|%d", js.seed, date.Format(dateFormat), trg)
+	secs := int64(js.window / time.Second)
+	rnd := rand.New(rand.NewSource(int64(h.Sum64())))
+	return time.Duration(rnd.Int63n(2*secs+1)-secs) * time.Second
+}
+
+// Transitions : opens and closes as for a patch, each shifted by its offset for the day it opens on
+func (js *jitterSchedule) Transitions(from, to time.Time) []Transition {
+	result := []Transition{}
+	wraps := js.closes.At() < js.opens.At()
+	// shifts can move transitions a window either way
+	forEachDate(from.Add(-24*time.Hour-js.window), to.Add(js.window), js.loc, func(date time.Time) {
+		if !js.cal.Active(date) {
+			return
+		}
+		closesOn := date
+		if wraps {
+			closesOn = date.AddDate(0, 0, 1)
+		}
+		opens := wallClock(date, js.opens.At(), js.loc).Add(js.offset(date, 0))
+		closes := wallClock(closesOn, js.closes.At(), js.loc).Add(js.offset(date, 1))
+		if !closes.After(opens) {
+			return
+		}
+		result = append(result,
+			Transition{At: opens, Trigger: js.opens},
+			Transition{At: closes, Trigger: js.closes, Closes: true},
+		)
+	})
+	return inWindow(result, from, to)
+}
+
+// jitter : vacation mode patch, shifted by upto the jitter window everyday
+// without a seed, one is derived from the schedule so that its the same every time the schedule is read
+func (jrs *JSONRelayState) jitter(ons, offs []*RelayState, loc *time.Location) (Schedule, error) {
+	if jrs.Primary {
+		return nil, fmt.Errorf("Jitter is only for patch schedules, cannot be primary")
+	}
+	if IsCron(jrs.ON) || IsCron(jrs.OFF) {
+		return nil, fmt.Errorf("Jitter cannot be on cron expressions")
+	}
+	window, err := time.ParseDuration(jrs.Jitter)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read jitter for schedule: %s", err)
+	}
+	on, off, err := jrs.triggers(ons, offs, loc)
+	if err != nil {
+		return nil, err
+	}
+	seed := jrs.Seed
+	if seed == 0 {
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%s|%s|%v", jrs.ON, jrs.OFF, jrs.IDs)
+		seed = int64(h.Sum64())
+	}
+	return NewJitterSchedule(on, off, window, seed)
+}
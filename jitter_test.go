@@ -0,0 +1,61 @@
+package scheduling
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestJitter : vacation mode patches shift within the window everyday, the same way for the same seed
+func TestJitter(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "07:00 PM", OFF: "11:00 PM", IDs: []string{"IN3"}, TZ: "UTC", Jitter: "20m", Seed: 42},
+		{ON: "06:30 PM", OFF: "06:45 PM", IDs: []string{"IN3"}, TZ: "UTC"},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	away := scheds[0]
+	assert.Equal(t, "07:00 PM - 11:00 PM [IN3] jitter 20m0s ", fmt.Sprintf("%s", away))
+	// the patch is clear of 07:00 PM, but not of 06:40 PM when the jitter could open it
+	assert.Equal(t, 1, scheds[1].Conflicts())
+
+	from := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	trans := away.Transitions(from, from.Add(30*24*time.Hour))
+	assert.Equal(t, 60, len(trans))
+	opens := map[time.Duration]bool{}
+	for i := 0; i < len(trans); i += 2 {
+		day := time.Date(2021, 8, 1+i/2, 0, 0, 0, 0, time.UTC)
+		onAt, offAt := trans[i].At.Sub(day.Add(19*time.Hour)), trans[i+1].At.Sub(day.Add(23*time.Hour))
+		assert.True(t, onAt >= -20*time.Minute && onAt <= 20*time.Minute, "ON shifted by %s", onAt)
+		assert.True(t, offAt >= -20*time.Minute && offAt <= 20*time.Minute, "OFF shifted by %s", offAt)
+		assert.True(t, trans[i+1].Closes)
+		opens[onAt] = true
+	}
+	assert.True(t, len(opens) > 1, "ON was expected at different times on different days")
+
+	// same seed, same times and not so for another seed
+	same := SliceOfJSONRelayState{{ON: "07:00 PM", OFF: "11:00 PM", IDs: []string{"IN3"}, TZ: "UTC", Jitter: "20m", Seed: 42}}
+	other := SliceOfJSONRelayState{{ON: "07:00 PM", OFF: "11:00 PM", IDs: []string{"IN3"}, TZ: "UTC", Jitter: "20m", Seed: 7}}
+	again, another := []Schedule{}, []Schedule{}
+	assert.Nil(t, same.ToSchedules(&again))
+	assert.Nil(t, other.ToSchedules(&another))
+	assert.Equal(t, trans, again[0].Transitions(from, from.Add(30*24*time.Hour)))
+	assert.NotEqual(t, trans, another[0].Transitions(from, from.Add(30*24*time.Hour)))
+	assert.Equal(t, 1, len(DiffSchedules(again, another).Modified), "Seed is part of the schedule")
+
+	nr, _, pre, _ := away.ToTaskAt(time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, trans[0].Trigger, nr)
+	assert.Equal(t, away.Delay()+int(trans[0].At.Sub(time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC))/time.Second), pre)
+
+	bad := []JSONRelayState{
+		{ON: "07:00 PM", OFF: "11:00 PM", IDs: []string{"IN3"}, Jitter: "2h"},
+		{ON: "07:00 PM", OFF: "11:00 PM", IDs: []string{"IN3"}, Jitter: "20m", Primary: true},
+		{ON: "07:00 PM", OFF: "11:00 PM", IDs: []string{"IN3"}, Jitter: "20"},
+	}
+	for _, b := range bad {
+		_, err := b.ToSchedule()
+		assert.NotNil(t, err, "Was expecting an error for %v", b)
+	}
+}
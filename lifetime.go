@@ -0,0 +1,92 @@
+package scheduling
+
+import (
+	"fmt"
+	"time"
+)
+
+// Lifetime : how long a schedule lives before it retires, the zero value lives forever
+type Lifetime struct {
+	// Runs : number of cycles the schedule is applied for, 0 for no limit
+	Runs int
+	// Expires : instant after which the schedule does not apply anymore, zero for never
+	Expires time.Time
+}
+
+// Forever : lifetime of schedules that never retire
+var Forever = Lifetime{}
+
+// Once : lifetime of schedules that are applied for just one cycle, as in tonight only
+var Once = Lifetime{Runs: 1}
+
+// Over : true if the lifetime has run its course after the cycles done, at the time given
+func (lt Lifetime) Over(runs int, now time.Time) bool {
+	if lt.Runs > 0 && runs >= lt.Runs {
+		return true
+	}
+	return !lt.Expires.IsZero() && !now.Before(lt.Expires)
+}
+
+func (lt Lifetime) String() string {
+	switch {
+	case lt.Runs > 0 && !lt.Expires.IsZero():
+		return fmt.Sprintf("%d runs till %s", lt.Runs, lt.Expires.Format(time.RFC3339))
+	case lt.Runs > 0:
+		return fmt.Sprintf("%d runs", lt.Runs)
+	case !lt.Expires.IsZero():
+		return fmt.Sprintf("till %s", lt.Expires.Format(time.RFC3339))
+	}
+	return "forever"
+}
+
+// NewLifetime : lifetime from the json fields, expires is RFC3339 or 2006-01-02 15:04 in the zone given
+func NewLifetime(once bool, runs int, expires string, loc *time.Location) (Lifetime, error) {
+	lt := Lifetime{Runs: runs}
+	if runs < 0 {
+		return lt, fmt.Errorf("runs cannot be negative")
+	}
+	if once {
+		if runs > 1 {
+			return lt, fmt.Errorf("schedule cannot run once and %d times", runs)
+		}
+		lt.Runs = 1
+	}
+	if expires != "" {
+		var err error
+		if lt.Expires, err = time.Parse(time.RFC3339, expires); err != nil {
+			if lt.Expires, err = time.ParseInLocation("2006-01-02 15:04", expires, loc); err != nil {
+				return lt, fmt.Errorf("invalid expiry %s, expected as RFC3339 or 2006-01-02 15:04", expires)
+			}
+		}
+	}
+	return lt, nil
+}
+
+// Event : what happened to a schedule, apart from the relay states that go out on send
+type Event struct {
+	Kind     string    `json:"kind"`
+	Schedule string    `json:"schedule"`
+	At       time.Time `json:"at"`
+}
+
+// EventExpired : the schedule has run its lifetime, or has no transitions left, and its loop has exited
+const EventExpired = "expired"
+
+func (ev Event) String() string {
+	return fmt.Sprintf("%s %s at %s", ev.Schedule, ev.Kind, ev.At.Format(time.RFC3339))
+}
+
+// expiredAt : true if the schedule has nothing more to apply at the time given
+// either its lifetime is over, its next cycle would end only after it expires, or it has no more transitions at all
+// A cycle is never started if it cannot be completed, so that relays are not left half way thru a cycle
+func expiredAt(sch Schedule, now time.Time) bool {
+	if sch.Expired(now) {
+		return true
+	}
+	nr, _, pre, post := sch.ToTaskAt(now)
+	if nr == nil {
+		return true
+	}
+	expires := sch.Lifetime().Expires
+	return !expires.IsZero() && now.Add(time.Duration(pre+post)*time.Second).After(expires)
+}
@@ -0,0 +1,146 @@
+package scheduling
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Override : relays forced to a state by hand, from till until over all the schedules on them, zero until is till released
+// Overrides are kept as they are so that they can be saved, and added back to the engine on restart
+type Override struct {
+	IDs   []string  `json:"ids" bson:"ids"`
+	State byte      `json:"state" bson:"state"`
+	From  time.Time `json:"from" bson:"from"`
+	Until time.Time `json:"until" bson:"until"`
+}
+
+// overrideSchedule : patch that is in effect just the once, from the time of the override till it expires or is released
+// its of PriorityManual and so wins over the schedules on the relays, when it closes the relays are left as they are unless a schedule is in effect on them
+type overrideSchedule struct {
+	*patchSchedule
+	ov Override
+}
+
+// NewOverride : schedule for the override, of PriorityManual
+func NewOverride(ov Override) (Schedule, error) {
+	if len(ov.IDs) == 0 {
+		return nil, fmt.Errorf("override has to be on at least one relay")
+	}
+	if ov.From.IsZero() {
+		return nil, fmt.Errorf("override has to be from a time")
+	}
+	if !ov.Until.IsZero() && !ov.Until.After(ov.From) {
+		return nil, fmt.Errorf("override till %s has to be after %s", ov.Until.Format(time.RFC3339), ov.From.Format(time.RFC3339))
+	}
+	states := []*RelayState{}
+	for _, id := range ov.IDs {
+		states = append(states, NewRelayLevel(id, ov.State))
+	}
+	secs := func(t time.Time) int {
+		h, m, s := t.Clock()
+		return h*3600 + m*60 + s
+	}
+	// the triggers are the same state, nothing changes when the override closes, unless a schedule is in effect on the relays
+	higher := NewTrg(secs(ov.From), states...)
+	if !ov.Until.IsZero() {
+		higher = NewTrg(secs(ov.Until), states...)
+	}
+	ovs := &overrideSchedule{ov: ov}
+	ovs.patchSchedule = &patchSchedule{primarySched: &primarySched{lower: NewTrg(secs(ov.From), states...), higher: higher, loc: ov.From.Location(), cal: EveryDay, priority: PriorityManual}}
+	return ovs.own(ovs), nil
+}
+
+func (ovs *overrideSchedule) String() string {
+	if ovs.ov.Until.IsZero() {
+		return fmt.Sprintf("override %v at %d since %s ", ovs.ov.IDs, ovs.ov.State, ovs.ov.From.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("override %v at %d since %s till %s ", ovs.ov.IDs, ovs.ov.State, ovs.ov.From.Format(time.RFC3339), ovs.ov.Until.Format(time.RFC3339))
+}
+
+// Transitions : the override, and when it expires, just the once
+func (ovs *overrideSchedule) Transitions(from, to time.Time) []Transition {
+	result := []Transition{{At: ovs.ov.From, Trigger: ovs.lower}}
+	if !ovs.ov.Until.IsZero() {
+		result = append(result, Transition{At: ovs.ov.Until, Trigger: ovs.higher, Closes: true})
+	}
+	return inWindow(result, from, to)
+}
+
+// Override : forces the relays to the state over all the schedules on them, and gives out the schedule of the override
+// When the override expires the relays are handed back to the schedules on them, in the state they are in by then
+func (eng *Engine) Override(ov Override) (Schedule, error) {
+	sch, err := NewOverride(ov)
+	if err != nil {
+		return nil, err
+	}
+	eng.Add(sch)
+	return sch, nil
+}
+
+// OverrideFor : forces the relays to the state from now for the duration
+func (eng *Engine) OverrideFor(state byte, d time.Duration, ids ...string) (Schedule, error) {
+	now := eng.clk.Now()
+	return eng.Override(Override{IDs: ids, State: state, From: now, Until: now.Add(d)})
+}
+
+// OverrideTillNext : forces the relays to the state from now till the next transition of any of the schedules on them
+// if there is none, till the override is released
+func (eng *Engine) OverrideTillNext(state byte, ids ...string) (Schedule, error) {
+	eng.mu.Lock()
+	now := eng.clk.Now()
+	var until time.Time
+	for _, id := range ids {
+		for _, sch := range eng.byRelay[id] {
+			if next, ok := nextTransition(sch, now); ok && (until.IsZero() || next.At.Before(until)) {
+				until = next.At
+			}
+		}
+	}
+	eng.mu.Unlock()
+	return eng.Override(Override{IDs: ids, State: state, From: now, Until: until})
+}
+
+// Release : ends the override now, and hands the relays back to the schedules on them
+// false if the override is not in the engine
+func (eng *Engine) Release(sch Schedule) bool {
+	ovs, ok := sch.(*overrideSchedule)
+	if !ok {
+		return false
+	}
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	d, ok := eng.pending[ovs]
+	if !ok {
+		return false
+	}
+	ovs.ov.Until = eng.clk.Now()
+	if !ovs.ov.Until.After(ovs.ov.From) {
+		ovs.ov.Until = ovs.ov.From.Add(time.Nanosecond)
+	}
+	if d != nil {
+		heap.Remove(&eng.queue, d.index)
+	}
+	eng.push(&dispatch{at: ovs.ov.Until, sched: ovs, trans: Transition{At: ovs.ov.Until, Trigger: ovs.higher, Closes: true}})
+	eng.poke()
+	return true
+}
+
+// Overrides : overrides in the engine in the order they were forced, to be saved and added back after a restart
+func (eng *Engine) Overrides() []Override {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	scheds := []*overrideSchedule{}
+	for sch := range eng.pending {
+		if ovs, ok := sch.(*overrideSchedule); ok {
+			scheds = append(scheds, ovs)
+		}
+	}
+	sort.Slice(scheds, func(i, j int) bool { return eng.added[scheds[i]] < eng.added[scheds[j]] })
+	result := []Override{}
+	for _, ovs := range scheds {
+		result = append(result, ovs.ov)
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOverride : relays forced by hand win over the schedules till the override expires or is released, and are then handed back
+func TestOverride(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, TZ: "UTC", Primary: true},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	start := time.Date(2021, 8, 1, 17, 0, 0, 0, time.UTC)
+	fc := NewFakeClock(start)
+	send, errx, events := make(chan []byte), make(chan error, 10), make(chan Event, 10)
+	msgs := collectSends(send)
+	eng := NewEngine(fc, send, errx, events)
+	eng.Add(scheds...)
+
+	_, err := eng.OverrideFor(1, 30*time.Minute, "IN1")
+	assert.Nil(t, err)
+	tillNext, err := eng.OverrideTillNext(1, "IN2")
+	assert.Nil(t, err)
+	assert.Equal(t, PriorityManual, tillNext.Priority())
+	assert.Equal(t, time.Date(2021, 8, 1, 18, 30, 0, 0, time.UTC), tillNext.(*overrideSchedule).ov.Until, "Was expected till the primary turns ON")
+	held, err := eng.Override(Override{IDs: []string{"IN1"}, State: 1, From: time.Date(2021, 8, 1, 19, 0, 0, 0, time.UTC)})
+	assert.Nil(t, err)
+	_, err = eng.Override(Override{IDs: []string{"IN1"}, State: 1, From: start, Until: start})
+	assert.NotNil(t, err)
+
+	stop := make(chan interface{})
+	defer close(stop)
+	go eng.Run(stop)
+	fc.BlockUntil(1)
+	fc.Advance(19 * time.Hour)
+	fc.BlockUntil(1)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, EventExpired, (<-events).Kind)
+	}
+	saved := eng.Overrides()
+	assert.Equal(t, 1, len(saved))
+	assert.Equal(t, []string{"IN1"}, saved[0].IDs)
+	assert.True(t, saved[0].Until.IsZero())
+
+	// released, IN1 is handed back to the primary that has it OFF by now
+	assert.True(t, eng.Release(held))
+	assert.False(t, eng.Release(scheds[0]), "Only overrides can be released")
+	assert.Equal(t, EventExpired, (<-events).Kind)
+	assert.Equal(t, 0, len(eng.Overrides()))
+	assert.False(t, eng.Release(held))
+
+	// overrides win when added, the first one hands IN1 back to the primary when it expires at 05:30 PM
+	// the one with no expiry holds IN1 past 06:30 AM till its released
+	assert.Equal(t, []string{
+		`{"IN1":1,"IN2":1}`,
+		`{"IN1":0}`,
+		`{"IN1":1}`,
+		`{"IN2":0}`,
+		`{"IN1":0}`,
+	}, msgs())
+	assert.Equal(t, 0, len(errx))
+
+	// only overrides stay in the engine with nothing more to dispatch, a primary past the end of its calendar expires
+	jrs = SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1"}, TZ: "UTC", Primary: true, Until: "2021-08-01"},
+	}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	fc = NewFakeClock(time.Date(2021, 8, 1, 19, 0, 0, 0, time.UTC))
+	send = make(chan []byte)
+	eng = NewEngine(fc, send, errx, events)
+	eng.Add(scheds...)
+	stop2 := make(chan interface{})
+	defer close(stop2)
+	go eng.Run(stop2)
+	assert.Equal(t, `{"IN1":1}`, string(<-send))
+	assert.Equal(t, EventExpired, (<-events).Kind)
+	assert.Equal(t, 0, len(eng.Schedules()))
+}
@@ -1,33 +1,71 @@
 package scheduling
 
+import (
+	"fmt"
+	"time"
+)
+
+// patchSchedule : not circular as the primary, its in effect only between its triggers, and allows pre sleep
 type patchSchedule struct {
 	*primarySched
+	// wraps : the patch opens at the higher trigger and closes at the lower one on the next day, crossing midnight
+	wraps bool
+}
+
+func (pas *patchSchedule) Wraps() bool {
+	return pas.wraps
+}
+
+// Duration : seconds the patch is in effect, for a patch that wraps its from the higher trigger till midnight and on to the lower one
+func (pas *patchSchedule) Duration() int {
+	if pas.wraps {
+		return 86400 - pas.primarySched.Duration()
+	}
+	return pas.primarySched.Duration()
 }
 
-func (pas *patchSchedule) ToTask() (Trigger, Trigger, int, int) {
-	elapsed := ElapsedSecondsNow()
-	var nr, fr Trigger
-	// When its a patch schedule pre sleep is contextual as well.
-	pre := pas.Delay()
-	post := 0
-	// Patch schedules are not circular
-	// They allow pre sleep and are effective only between the triggers from top to bottom
-	// so for all the cases the near trigger is the lower and the far one is the higher
-	nr, fr = pas.lower, pas.higher
-	if elapsed >= pas.lower.At() && elapsed < pas.higher.At() {
-		// Case of in between ..no pre sleep
-		post = pas.higher.At() - elapsed
-	} else {
-		// current time beyond the triggers, pre sleep comes into play
-		post = pas.higher.At() - pas.lower.At()
-		if elapsed < pas.lower.At() {
-			pre += pas.lower.At() - elapsed
+// Midpoint : for a patch that wraps it could be either side of midnight, but always within the day
+func (pas *patchSchedule) Midpoint() int {
+	if pas.wraps {
+		return (pas.higher.At() + pas.Duration()/2) % 86400
+	}
+	return pas.primarySched.Midpoint()
+}
+func (pas *patchSchedule) String() string {
+	if pas.wraps {
+		return fmt.Sprintf("%s - %s %v ", TmStrFromUnixSecs(pas.higher.At()), TmStrFromUnixSecs(pas.lower.At()), pas.lower.RelayIDs())
+	}
+	return pas.primarySched.String()
+}
+
+// Transitions : the lower trigger opens and the higher one closes the patch on every day it is in effect
+// A patch that wraps opens with the higher trigger on the day it is in effect, and closes with the lower one the day after
+// On days when the clock shift squeezes the patch to nothing, or the sun does not rise or set, it does not open at all
+func (pas *patchSchedule) Transitions(from, to time.Time) []Transition {
+	result := []Transition{}
+	opener, closer := pas.lower, pas.higher
+	if pas.wraps {
+		opener, closer = pas.higher, pas.lower
+	}
+	forEachDate(from.Add(-24*time.Hour), to, pas.loc, func(date time.Time) {
+		if !pas.cal.Active(date) {
+			return
 		}
-		if elapsed >= pas.higher.At() {
-			pre += 86400 - elapsed + pas.lower.At()
+		closesOn := date
+		if pas.wraps {
+			closesOn = date.AddDate(0, 0, 1)
 		}
-	}
-	return nr, fr, pre, post
+		opens, ok1 := triggerInstant(opener, date, pas.loc)
+		closes, ok2 := triggerInstant(closer, closesOn, pas.loc)
+		if !ok1 || !ok2 || !closes.After(opens) {
+			return
+		}
+		result = append(result,
+			Transition{At: opens, Trigger: opener},
+			Transition{At: closes, Trigger: closer, Closes: true},
+		)
+	})
+	return inWindow(result, from, to)
 }
 
 // Please be ware here another cannot be a primary schedule
@@ -35,6 +73,9 @@ func (pas *patchSchedule) ConflictsWith(another Schedule) bool {
 	// https://eensymachines-in.github.io/luminapi/schedule-conflicts
 	// Read here patch schedules conflict with other patch schedules only in the case of overlap and intersection
 	// in all other cases if the schedules are delayed incase of intersection
+	if !pas.cal.Overlaps(another.Calendar()) {
+		return false // never in effect on the same day
+	}
 	outside, inside, overlap, coinc := overlapsWith(pas, another)
 	// Getting if there's an intersection on the relays
 	anLw, _ := another.Triggers()
@@ -52,8 +93,8 @@ func (pas *patchSchedule) ConflictsWith(another Schedule) bool {
 		return false
 	}
 	if overlap && intersects {
-		_, ok := another.(*patchSchedule)
-		return ok // if the schedule type is not patchSchedule conflict cannot be determined
+		_, primary := another.(*primarySched)
+		return !primary // if the schedule type is primary conflict cannot be determined here
 	}
 	return false // if the schedules either does not overlap or does not intersect
 }
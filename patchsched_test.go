@@ -0,0 +1,94 @@
+package scheduling
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMidnightPatches : patches that cross midnight open on one day and close on the next, and are conflict checked on a circular day
+func TestMidnightPatches(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, TZ: "UTC", Primary: true},
+		{ON: "11:00 PM", OFF: "01:00 AM", IDs: []string{"IN3"}, TZ: "UTC"},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	night := scheds[1]
+	assert.True(t, night.Wraps())
+	assert.False(t, scheds[0].Wraps())
+	assert.Equal(t, 7200, night.Duration(), "Patch should have been 2 hours and not 22")
+	assert.Equal(t, 0, night.Midpoint())
+	assert.Equal(t, "11:00 PM - 01:00 AM [IN3] ", fmt.Sprintf("%s", night))
+
+	from := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	trans := night.Transitions(from, from.Add(24*time.Hour))
+	assert.Equal(t, 2, len(trans))
+	assert.Equal(t, time.Date(2021, 8, 1, 23, 0, 0, 0, time.UTC), trans[0].At)
+	assert.Equal(t, byte(1), trans[0].Trigger.States()["IN3"])
+	assert.Equal(t, time.Date(2021, 8, 2, 1, 0, 0, 0, time.UTC), trans[1].At)
+	assert.True(t, trans[1].Closes)
+	// just past midnight, the patch is still in effect
+	nr, fr, pre, post := night.ToTaskAt(time.Date(2021, 8, 2, 0, 30, 0, 0, time.UTC))
+	assert.Equal(t, trans[0].Trigger, nr)
+	assert.Equal(t, trans[1].Trigger, fr)
+	assert.Equal(t, night.Delay(), pre)
+	assert.Equal(t, 1800, post)
+
+	on := func(at string, ids ...string) Trigger {
+		secs, err := TimeStr(at).ToElapsedTm()
+		assert.Nil(t, err)
+		states := []*RelayState{}
+		for _, id := range ids {
+			states = append(states, &RelayState{byte(1), id})
+		}
+		return NewTrg(secs, states...)
+	}
+	off := func(at string, ids ...string) Trigger {
+		secs, err := TimeStr(at).ToElapsedTm()
+		assert.Nil(t, err)
+		states := []*RelayState{}
+		for _, id := range ids {
+			states = append(states, &RelayState{byte(0), id})
+		}
+		return NewTrg(secs, states...)
+	}
+	patch := func(opens, closes string) Schedule {
+		sch, err := NewPatchSchedule(on(opens, "IN3"), off(closes, "IN3"))
+		assert.Nil(t, err)
+		return sch
+	}
+	cases := []struct {
+		other                              Schedule
+		outside, inside, overlap, coincide bool
+	}{
+		{patch("12:30 AM", "02:00 AM"), false, false, true, false},
+		{patch("10:00 PM", "11:30 PM"), false, false, true, false},
+		{patch("11:30 PM", "12:30 AM"), false, true, false, false},
+		{patch("10:00 PM", "03:00 AM"), false, true, false, false},
+		{patch("01:00 AM", "02:00 AM"), false, false, false, true},
+		{patch("11:00 PM", "11:30 PM"), false, false, false, true},
+		{patch("02:00 AM", "10:00 PM"), true, false, false, false},
+		{patch("06:00 AM", "08:00 AM"), true, false, false, false},
+	}
+	for _, c := range cases {
+		ou, in, ov, co := overlapsWith(night, c.other)
+		assert.Equal(t, []bool{c.outside, c.inside, c.overlap, c.coincide}, []bool{ou, in, ov, co}, "%s with %s", night, c.other)
+		assert.Equal(t, c.overlap, night.ConflictsWith(c.other), "%s with %s", night, c.other)
+	}
+
+	// primary is ON thru the night, a patch that straddles its ON trigger still conflicts
+	primary := scheds[0]
+	assert.False(t, primary.ConflictsWith(night))
+	evening, err := NewPatchSchedule(on("06:00 PM", "IN1"), off("07:00 PM", "IN1"))
+	assert.Nil(t, err)
+	assert.True(t, primary.ConflictsWith(evening))
+	dawn, err := NewPatchSchedule(on("11:00 PM", "IN1"), off("07:00 AM", "IN1"))
+	assert.Nil(t, err)
+	assert.True(t, primary.ConflictsWith(dawn), "Patch wraps past the OFF trigger of the primary")
+	c := newConflict(primary, dawn)
+	assert.Equal(t, 6*3600+30*60, c.From)
+	assert.Equal(t, 7*3600, c.To)
+}
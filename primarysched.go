@@ -2,6 +2,7 @@ package scheduling
 
 import (
 	"fmt"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -13,7 +14,36 @@ type primarySched struct {
 	higher Trigger
 	// whenever the schedule gets in a conflict the LHS induces increment in the RHS conflict
 	conflicts int
-	delay     int // increasing this will increment the preceedence since this will be applied after a delay
+	delay     int // increasing this will increment the preceedence since this will be applied after a delay, only with Apply and Loop
+	// time zone in which the trigger times are read, elapsed seconds are computed on the wall clock of this zone
+	loc *time.Location
+	// days on which the schedule is in effect, triggers do not fire on any other day
+	cal Calendar
+	// how long the schedule lives, and the cycles it has been applied for
+	life Lifetime
+	runs int
+	// why the schedule is in conflict, one for each conflict counted
+	clashes ConflictReport
+	// of the schedules in effect on a relay, the one with the highest priority wins
+	priority int
+	// rest : relays all OFF, as the primary leaves them when its suppressed on a holiday
+	rest Trigger
+	// self : the schedule this is embedded in, as for patches and the schedules made of them
+	self Schedule
+}
+
+// own : the schedule embedding this is what the builders give out, and what the task is worked out from
+func (ps *primarySched) own(sch Schedule) Schedule {
+	ps.self = sch
+	return sch
+}
+
+// outer : the schedule as a whole, which is this one unless its embedded
+func (ps *primarySched) outer() Schedule {
+	if ps.self != nil {
+		return ps.self
+	}
+	return ps
 }
 
 func (ps *primarySched) Conflicts() int {
@@ -21,7 +51,21 @@ func (ps *primarySched) Conflicts() int {
 }
 func (ps *primarySched) AddConflict() Schedule {
 	ps.conflicts++
-	return ps
+	return ps.outer()
+}
+func (ps *primarySched) Clashes() ConflictReport {
+	return ps.clashes
+}
+func (ps *primarySched) AddClash(c Conflict) Schedule {
+	ps.clashes = append(ps.clashes, c)
+	return ps.outer()
+}
+func (ps *primarySched) Priority() int {
+	return ps.priority
+}
+func (ps *primarySched) WithPriority(p int) Schedule {
+	ps.priority = p
+	return ps.outer()
 }
 func (ps *primarySched) Delay() int {
 	return ps.delay
@@ -29,7 +73,44 @@ func (ps *primarySched) Delay() int {
 func (ps *primarySched) AddDelay(prior int) Schedule {
 	ps.delay = prior
 	ps.delay++
-	return ps
+	return ps.outer()
+}
+func (ps *primarySched) Location() *time.Location {
+	return ps.loc
+}
+func (ps *primarySched) InLocation(loc *time.Location) Schedule {
+	if loc != nil {
+		ps.loc = loc
+	}
+	return ps.outer()
+}
+func (ps *primarySched) Calendar() Calendar {
+	return ps.cal
+}
+func (ps *primarySched) OnCalendar(cal Calendar) Schedule {
+	ps.cal = cal
+	return ps.outer()
+}
+func (ps *primarySched) Lifetime() Lifetime {
+	return ps.life
+}
+func (ps *primarySched) WithLifetime(lt Lifetime) Schedule {
+	ps.life = lt
+	return ps.outer()
+}
+func (ps *primarySched) Runs() int {
+	return ps.runs
+}
+func (ps *primarySched) AddRun() Schedule {
+	ps.runs++
+	return ps.outer()
+}
+func (ps *primarySched) Expired(now time.Time) bool {
+	return ps.life.Over(ps.runs, now)
+}
+func (ps *primarySched) Wraps() bool {
+	// primary schedules are circular, they do not have to wrap
+	return false
 }
 func (ps *primarySched) Triggers() (Trigger, Trigger) {
 	return ps.lower, ps.higher
@@ -52,29 +133,55 @@ func (ps *primarySched) String() string {
 // For any schedule when its applied - pre sleep - nr state apply - post sleep - fr state apply
 // For a primary schedule its thought to be circular, meaning to say : if beyond the trigger bounds the higher trigger is applied
 func (ps *primarySched) ToTask() (Trigger, Trigger, int, int) {
-	// for primary schedule nr trigger will be applied then, sleep, then fr state
-	// for primary schedule there is no pre sleep - since its circular and applies beyond the 2 triggers as well
-	elapsed := ElapsedSecondsNow()
-	var nr, fr Trigger
-	var post int
-	pre := ps.Delay()
-	if elapsed >= ps.lower.At() && elapsed < ps.higher.At() {
-		nr, fr = ps.lower, ps.higher
-		post = ps.higher.At() - elapsed
-	} else {
-		nr, fr = ps.higher, ps.lower
-		if elapsed < ps.lower.At() {
-			post = ps.lower.At() - elapsed
+	return ps.outer().ToTaskAt(time.Now())
+}
+
+// ToTaskAt : same as ToTask but in the context of the time given instead of the current time
+// for primary schedule nr trigger will be applied then, sleep, then fr state
+// for primary schedule there is no pre sleep - since its circular and applies beyond the 2 triggers as well
+// the other kinds of schedules embed this, and theirs is worked out the same from their own transitions
+// as one opening or closing of a patch, one step of a sequence or ramp, or one edge of a pulse at a time
+func (ps *primarySched) ToTaskAt(now time.Time) (Trigger, Trigger, int, int) {
+	return toTask(ps.outer(), now)
+}
+
+// Transitions : both the triggers on every day the schedule is in effect
+// the higher one is followed by the lower one on the next day in effect, state of the higher trigger holds thru the days in between
+// Holidays are different, the primary closes at the start of the holiday with its relays OFF, and is out of effect till its next trigger after it
+func (ps *primarySched) Transitions(from, to time.Time) []Transition {
+	result := []Transition{}
+	forEachDate(from.Add(-24*time.Hour), to, ps.loc, func(date time.Time) {
+		if !ps.cal.Active(date) {
+			if ps.suppressedOn(date) {
+				result = append(result, Transition{At: wallClock(date, 0, ps.loc), Trigger: ps.rest, Closes: true})
+			}
+			return
 		}
-		if elapsed > ps.higher.At() {
-			post = 86400 - elapsed + ps.lower.At()
+		for _, trg := range []Trigger{ps.lower, ps.higher} {
+			if at, ok := triggerInstant(trg, date, ps.loc); ok {
+				result = append(result, Transition{At: at, Trigger: trg})
+			}
 		}
+	})
+	return inWindow(result, from, to)
+}
+
+// suppressedOn : true on the first day of a holiday that the primary would otherwise be in effect on
+func (ps *primarySched) suppressedOn(date time.Time) bool {
+	if ps.rest == nil || !ps.cal.Except.On(date) || ps.cal.Except.On(date.AddDate(0, 0, -1)) {
+		return false
 	}
-	return nr, fr, pre, post
+	cal := ps.cal
+	cal.Except = nil
+	return cal.Active(date)
 }
 
 // ConflictsWith : checks to see partial overlapping of schedules
 func (ps *primarySched) ConflictsWith(another Schedule) bool {
+	if !ps.cal.Overlaps(another.Calendar()) {
+		// schedules that are never in effect on the same day cannot conflict
+		return false
+	}
 	_, ok := another.(*primarySched)
 	if ok {
 		// Always conflicts with other primary schedule
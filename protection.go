@@ -0,0 +1,227 @@
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Protection : limits on how often relays may switch, for compressors and pumps that are damaged by short cycles
+// A relay once ON stays ON for atleast MinOn, once OFF stays OFF for atleast MinOff, and is not switched ON more than MaxPerHour times in any hour
+// Level changes while ON are not switches
+type Protection struct {
+	IDs    []string
+	MinOn  time.Duration
+	MinOff time.Duration
+	// MaxPerHour : 0 for no limit
+	MaxPerHour int
+}
+
+// NewProtection : protection on atleast one relay, with atleast one of the limits
+func NewProtection(minOn, minOff time.Duration, maxPerHour int, ids ...string) (Protection, error) {
+	if len(ids) == 0 {
+		return Protection{}, fmt.Errorf("protection has to be on atleast one relay")
+	}
+	if minOn < 0 || minOff < 0 || maxPerHour < 0 {
+		return Protection{}, fmt.Errorf("limits of a protection cannot be negative")
+	}
+	if minOn == 0 && minOff == 0 && maxPerHour == 0 {
+		return Protection{}, fmt.Errorf("protection has to have atleast one of the limits")
+	}
+	return Protection{IDs: append([]string{}, ids...), MinOn: minOn, MinOff: minOff, MaxPerHour: maxPerHour}, nil
+}
+
+func (p Protection) String() string {
+	return fmt.Sprintf("protection %v min on %s min off %s max %d/h", p.IDs, p.MinOn, p.MinOff, p.MaxPerHour)
+}
+
+// has : true if the relay is one of the protection
+func (p Protection) has(id string) bool {
+	for _, i := range p.IDs {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Limits of a protection that a switch can be against
+const (
+	LimitMinOn      = "min_on"
+	LimitMinOff     = "min_off"
+	LimitMaxPerHour = "max_per_hour"
+)
+
+// switching : history of a relay, when it last went ON and OFF, and when it was switched ON in the last hour
+type switching struct {
+	on     bool
+	onAt   time.Time
+	offAt  time.Time
+	starts []time.Time
+}
+
+// record : the relay switching to the state at the time, level changes are not switches
+func (sw *switching) record(state byte, at time.Time) {
+	if (state > 0) == sw.on {
+		return
+	}
+	sw.on = state > 0
+	if !sw.on {
+		sw.offAt = at
+		return
+	}
+	sw.onAt = at
+	recent := []time.Time{}
+	for _, t := range sw.starts {
+		if at.Sub(t) < time.Hour {
+			recent = append(recent, t)
+		}
+	}
+	sw.starts = append(recent, at)
+}
+
+// allowed : earliest the relay can be switched to the state as per the protection, and the limit that holds it back if its later than at
+// with no history, as when the relay was never switched, its always allowed
+func (sw *switching) allowed(p Protection, state byte, at time.Time) (time.Time, string) {
+	if (state > 0) == sw.on {
+		return at, ""
+	}
+	if !sw.on {
+		if sw.onAt.IsZero() {
+			// never ON, so never OFF either
+			return at, ""
+		}
+		if until := sw.offAt.Add(p.MinOff); until.After(at) {
+			return until, LimitMinOff
+		}
+		if n := len(sw.starts); p.MaxPerHour > 0 && n >= p.MaxPerHour {
+			if until := sw.starts[n-p.MaxPerHour].Add(time.Hour); until.After(at) {
+				return until, LimitMaxPerHour
+			}
+		}
+		return at, ""
+	}
+	if until := sw.onAt.Add(p.MinOn); until.After(at) {
+		return until, LimitMinOn
+	}
+	return at, ""
+}
+
+// ProtectionViolation : relay that the schedules switch before a limit of its protection allows it
+type ProtectionViolation struct {
+	Protection Protection
+	At         time.Time
+	Relay      string
+	State      byte
+	// Schedule : the one that switches the relay
+	Schedule string
+	// Limit : LimitMinOn, LimitMinOff or LimitMaxPerHour
+	Limit string
+	// Allowed : earliest the switch would have been allowed
+	Allowed time.Time
+}
+
+func (pv ProtectionViolation) String() string {
+	return fmt.Sprintf("%s %s=%d by %s against %s, not before %s, %s", pv.At.Format(time.RFC3339), pv.Relay, pv.State, pv.Schedule, pv.Limit, pv.Allowed.Format(time.RFC3339), pv.Protection)
+}
+
+// CheckProtections : previews the schedules over the window as in CompileTimeline, and gives out every switch of a relay that a limit of its protection does not allow
+func CheckProtections(scheds []Schedule, prots []Protection, from, to time.Time) []ProtectionViolation {
+	result := []ProtectionViolation{}
+	if len(prots) == 0 {
+		return result
+	}
+	history := map[string]*switching{}
+	for _, ev := range CompileTimeline(scheds, from, to).Events {
+		sw, ok := history[ev.Relay]
+		if !ok {
+			sw = &switching{}
+			history[ev.Relay] = sw
+		}
+		if !ev.Initial {
+			for _, p := range prots {
+				if !p.has(ev.Relay) {
+					continue
+				}
+				if until, limit := sw.allowed(p, ev.State, ev.At); limit != "" {
+					result = append(result, ProtectionViolation{Protection: p, At: ev.At, Relay: ev.Relay, State: ev.State, Schedule: ev.Schedule, Limit: limit, Allowed: until})
+				}
+			}
+		}
+		sw.record(ev.State, ev.At)
+	}
+	return result
+}
+
+// JSONProtection : protection as read from the schedule file, times as durations, "5m"
+type JSONProtection struct {
+	IDs        []string `json:"ids" bson:"ids"`
+	MinOn      string   `json:"min_on,omitempty" bson:"min_on,omitempty"`
+	MinOff     string   `json:"min_off,omitempty" bson:"min_off,omitempty"`
+	MaxPerHour int      `json:"max_per_hour,omitempty" bson:"max_per_hour,omitempty"`
+}
+
+// ToProtection : protection from the json, limits that are not given are 0
+func (jp JSONProtection) ToProtection() (Protection, error) {
+	durations := []time.Duration{0, 0}
+	for i, s := range []string{jp.MinOn, jp.MinOff} {
+		if s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return Protection{}, fmt.Errorf("Failed to read minimum on/off time for protection: %s", err)
+		}
+		durations[i] = d
+	}
+	return NewProtection(durations[0], durations[1], jp.MaxPerHour, jp.IDs...)
+}
+
+// Protect : limits the engine enforces on switching the relays, these replace the ones before
+// A switch that is too soon is not sent but deferred till the limit allows it, when the relay is resolved over the schedules again
+// so that if the schedules have since switched it back, nothing is sent
+func (eng *Engine) Protect(prots ...Protection) {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	eng.prots = append([]Protection{}, prots...)
+}
+
+// Protections : limits the engine enforces
+func (eng *Engine) Protections() []Protection {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	return append([]Protection{}, eng.prots...)
+}
+
+// protect : states that can be sent right away, those that are too soon are deferred to when they are allowed
+// expects the lock to be held
+func (eng *Engine) protect(d *dispatch, states map[string]byte, now time.Time) map[string]byte {
+	if len(eng.prots) == 0 {
+		return states
+	}
+	ids := []string{}
+	for id := range states {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := map[string]byte{}
+	for _, id := range ids {
+		until := now
+		if sw, ok := eng.history[id]; ok {
+			for _, p := range eng.prots {
+				if !p.has(id) {
+					continue
+				}
+				if t, limit := sw.allowed(p, states[id], now); limit != "" && t.After(until) {
+					until = t
+				}
+			}
+		}
+		if !until.After(now) {
+			result[id] = states[id]
+			continue
+		}
+		eng.deferTill(d.sched, id, states[id], until)
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestProtection : relays switched too soon after they last switched are caught when read, and deferred by the engine
+func TestProtection(t *testing.T) {
+	_, err := NewProtection(0, 0, 0, "IN1")
+	assert.NotNil(t, err, "Protection has to have atleast one of the limits")
+	_, err = NewProtection(time.Minute, 0, 0)
+	assert.NotNil(t, err, "Protection has to be on atleast one relay")
+	_, err = JSONProtection{IDs: []string{"IN1"}, MinOff: "5 mins"}.ToProtection()
+	assert.NotNil(t, err)
+	minOff, err := JSONProtection{IDs: []string{"IN1"}, MinOff: "5m"}.ToProtection()
+	assert.Nil(t, err)
+
+	// the patch lets go of IN1 a minute before the primary has it ON again
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1"}, TZ: "UTC", Primary: true},
+		{ON: "06:00 PM", OFF: "06:29 PM", IDs: []string{"IN1"}, TZ: "UTC"},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	from := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	violations := CheckProtections(scheds, []Protection{minOff}, from, from.AddDate(0, 0, 1))
+	assert.Equal(t, 1, len(violations))
+	assert.Equal(t, LimitMinOff, violations[0].Limit)
+	assert.Equal(t, time.Date(2021, 8, 1, 18, 30, 0, 0, time.UTC), violations[0].At)
+	assert.Equal(t, time.Date(2021, 8, 1, 18, 34, 0, 0, time.UTC), violations[0].Allowed)
+	violations = CheckProtections(scheds, []Protection{{IDs: []string{"IN1"}, MaxPerHour: 1}}, from, from.AddDate(0, 0, 1))
+	assert.Equal(t, 1, len(violations))
+	assert.Equal(t, LimitMaxPerHour, violations[0].Limit)
+	violations = CheckProtections(scheds, []Protection{{IDs: []string{"IN1"}, MinOn: time.Hour}}, from, from.AddDate(0, 0, 1))
+	assert.Equal(t, 1, len(violations))
+	assert.Equal(t, LimitMinOn, violations[0].Limit, "The patch has IN1 ON for just 29 minutes")
+	assert.Equal(t, 0, len(CheckProtections(scheds, []Protection{{IDs: []string{"IN2"}, MinOff: time.Hour}}, from, from.AddDate(0, 0, 1))))
+
+	sf := ScheduleFile{TZ: "UTC", Schedules: jrs, Protections: []JSONProtection{{IDs: []string{"IN1"}, MinOff: "5m"}}}
+	assert.NotNil(t, sf.ToSchedules(&scheds), "Schedules against the protection are rejected when read")
+
+	// checked over the week from the instant given, COMP is ON for just 2 minutes only on the holiday
+	sf = ScheduleFile{TZ: "UTC", Schedules: SliceOfJSONRelayState{
+		{ON: "08:00 AM", OFF: "09:00 AM", IDs: []string{"COMP"}},
+	}, Holidays: []JSONHoliday{{Name: "Shutdown", Date: "2021-08-03", IDs: []string{"COMP"}, Schedules: SliceOfJSONRelayState{
+		{ON: "08:00 AM", OFF: "08:02 AM", IDs: []string{"COMP"}},
+	}}}, Protections: []JSONProtection{{IDs: []string{"COMP"}, MinOn: "5m"}}}
+	assert.NotNil(t, sf.ToSchedulesAt(&scheds, time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)))
+	assert.Nil(t, sf.ToSchedulesAt(&scheds, time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)), "holiday is not in the week")
+	// schedules that conflict never run, and are not checked
+	sf = ScheduleFile{TZ: "UTC", Schedules: SliceOfJSONRelayState{
+		{ON: "08:00 AM", OFF: "09:00 AM", IDs: []string{"COMP"}},
+		{ON: "08:30 AM", OFF: "09:02 AM", IDs: []string{"COMP"}},
+	}, Protections: []JSONProtection{{IDs: []string{"COMP"}, MinOn: "5m"}}}
+	assert.Nil(t, sf.ToSchedulesAt(&scheds, time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 1, scheds[1].Conflicts())
+
+	// the engine holds IN1 OFF till 06:34 PM, 5 minutes after the patch let go of it
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	fc := NewFakeClock(time.Date(2021, 8, 1, 17, 0, 0, 0, time.UTC))
+	send, errx := make(chan []byte), make(chan error, 10)
+	msgs := collectSends(send)
+	eng := NewEngine(fc, send, errx, nil)
+	eng.Protect(minOff)
+	assert.Equal(t, 1, len(eng.Protections()))
+	eng.Add(scheds...)
+	stop := make(chan interface{})
+	defer close(stop)
+	go eng.Run(stop)
+	fc.BlockUntil(1)
+	fc.Advance(time.Hour)
+	fc.BlockUntil(1)
+	fc.Advance(29 * time.Minute)
+	fc.BlockUntil(1)
+	fc.Advance(time.Minute)
+	fc.BlockUntil(1)
+	eng.mu.Lock()
+	assert.Equal(t, time.Date(2021, 8, 1, 18, 34, 0, 0, time.UTC), eng.queue[0].at, "Primary turning IN1 ON is deferred")
+	eng.mu.Unlock()
+	fc.Advance(4 * time.Minute)
+	fc.BlockUntil(1)
+	assert.Equal(t, []string{`{"IN1":0}`, `{"IN1":1}`, `{"IN1":0}`, `{"IN1":1}`}, msgs())
+	assert.Equal(t, 0, len(errx))
+
+	// the patch is run once and out of the engine right after it closes, COMP still goes OFF once its been ON 5 minutes
+	jrs = SliceOfJSONRelayState{{ON: "10:00 AM", OFF: "10:01 AM", IDs: []string{"COMP"}, TZ: "UTC", Once: true}}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	fc = NewFakeClock(time.Date(2021, 8, 1, 9, 0, 0, 0, time.UTC))
+	send = make(chan []byte)
+	eng = NewEngine(fc, send, errx, nil)
+	eng.Protect(Protection{IDs: []string{"COMP"}, MinOn: 5 * time.Minute})
+	eng.Add(scheds...)
+	stop2 := make(chan interface{})
+	defer close(stop2)
+	go eng.Run(stop2)
+	fc.BlockUntil(1)
+	fc.Advance(time.Hour)
+	assert.Equal(t, `{"COMP":1}`, string(<-send))
+	fc.BlockUntil(1)
+	fc.Advance(time.Minute)
+	fc.BlockUntil(1)
+	assert.Equal(t, 0, len(eng.Schedules()), "patch has expired")
+	fc.Advance(4 * time.Minute)
+	assert.Equal(t, `{"COMP":0}`, string(<-send))
+}
@@ -0,0 +1,165 @@
+package scheduling
+
+import (
+	"fmt"
+	"time"
+)
+
+// pulseTrg : trigger that pulses its relays, ON for the width of the pulse and OFF thereafter, rather than setting a state that holds
+// for latching contactors and gate openers, it marshals as the rising edge and its falling edge follows after the width
+type pulseTrg struct {
+	*rlyStateTrg
+	width time.Duration
+}
+
+// NewPulseTrg : pulse on the relays at seconds since midnight, the pulse has to be over before midnight
+func NewPulseTrg(secs int, width time.Duration, ids ...string) (Trigger, error) {
+	if width <= 0 {
+		return nil, fmt.Errorf("%s width of a pulse has to be more than nothing", width)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("pulse has to be on at least one relay")
+	}
+	if secs < 0 || secs+ceilSeconds(width) >= 86400 {
+		return nil, fmt.Errorf("%s pulse of %s has to start and be over within the day", TmStrFromUnixSecs(secs), width)
+	}
+	states := []*RelayState{}
+	for _, id := range ids {
+		states = append(states, &RelayState{byte(1), id})
+	}
+	return &pulseTrg{rlyStateTrg: NewTrg(secs, states...).(*rlyStateTrg), width: width}, nil
+}
+
+func (pt *pulseTrg) String() string {
+	return fmt.Sprintf("%s pulse %s", pt.rlyStateTrg, pt.width)
+}
+
+// Width : how long the relays are ON for
+func (pt *pulseTrg) Width() time.Duration {
+	return pt.width
+}
+
+// falling : the falling edge of the pulse, all the relays OFF at the second the pulse is over
+func (pt *pulseTrg) falling() Trigger {
+	states := []*RelayState{}
+	for _, id := range pt.RelayIDs() {
+		states = append(states, &RelayState{byte(0), id})
+	}
+	return NewTrg(pt.at+ceilSeconds(pt.width), states...)
+}
+
+// pulseSchedule : pulses the relays once on every day it is in effect
+// its a patch that opens with the rising edge and closes with the falling one, so relays no other schedule holds are left OFF
+// Pulses are in conflict with schedules that hold the same relays at the time, and with other pulses on them at the same time
+type pulseSchedule struct {
+	*patchSchedule
+	pulse *pulseTrg
+}
+
+// NewPulseSchedule : schedule of the pulse trigger, see NewPulseTrg
+func NewPulseSchedule(pulse Trigger) (Schedule, error) {
+	pt, ok := pulse.(*pulseTrg)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a pulse trigger", pulse)
+	}
+	ps := &pulseSchedule{pulse: pt}
+	ps.patchSchedule = &patchSchedule{primarySched: &primarySched{lower: pt, higher: pt.falling(), loc: time.Local, cal: EveryDay}}
+	return ps.own(ps), nil
+}
+
+func (ps *pulseSchedule) String() string {
+	return fmt.Sprintf("%s %v pulse %s ", TmStrFromUnixSecs(ps.pulse.At()), ps.pulse.RelayIDs(), ps.pulse.width)
+}
+
+// Transitions : the rising edge on every day the pulse is in effect, and the falling edge after the width of the pulse to the sub second
+func (ps *pulseSchedule) Transitions(from, to time.Time) []Transition {
+	result := []Transition{}
+	forEachDate(from.Add(-24*time.Hour), to, ps.loc, func(date time.Time) {
+		if !ps.cal.Active(date) {
+			return
+		}
+		rises := wallClock(date, ps.pulse.At(), ps.loc)
+		result = append(result,
+			Transition{At: rises, Trigger: ps.pulse},
+			Transition{At: rises.Add(ps.pulse.width), Trigger: ps.higher, Closes: true},
+		)
+	})
+	return inWindow(result, from, to)
+}
+
+// pulseClash : true if either of the schedules is a pulse, on relays the other one holds or pulses at the same time
+func pulseClash(left, right Schedule) bool {
+	lp, lPulse := left.(*pulseSchedule)
+	rp, rPulse := right.(*pulseSchedule)
+	if !lPulse && !rPulse {
+		return false
+	}
+	if !left.Calendar().Overlaps(right.Calendar()) {
+		return false
+	}
+	lLw, _ := left.Triggers()
+	rLw, _ := right.Triggers()
+	if !lLw.Intersects(rLw, false) {
+		return false
+	}
+	switch {
+	case lPulse && rPulse:
+		// either pulse rises before the other has fallen
+		ls, rs := time.Duration(lp.pulse.At())*time.Second, time.Duration(rp.pulse.At())*time.Second
+		return ls < rs+rp.pulse.width && rs < ls+lp.pulse.width
+	case lPulse:
+		return holdsDuring(right, lp.pulse)
+	default:
+		return holdsDuring(left, rp.pulse)
+	}
+}
+
+// holdsDuring : true if the schedule holds its relays at any time from the rise of the pulse till it falls, primary schedules hold them all day
+// a patch that opens while the pulse is high is as much a clash as one that is open when it rises, since the falling edge would cut it short
+func holdsDuring(sch Schedule, pt *pulseTrg) bool {
+	if _, ok := sch.(*primarySched); ok {
+		return true
+	}
+	start, length := arcOf(sch)
+	if pt.At() == start || inArc(start, length, pt.At()) {
+		return true
+	}
+	// the pulse is high for atleast the second it rises in
+	high := ceilSeconds(pt.width)
+	if high < 1 {
+		high = 1
+	}
+	return ((start-pt.At())%86400+86400)%86400 < high
+}
+
+// pulseAfter : how long after the near trigger the far one is applied, for a pulse its falling edge follows after just its width
+// for all else its a second more than the post sleep, so that the far trigger is applied in the next slot
+func pulseAfter(nr Trigger, post int) time.Duration {
+	if pt, ok := nr.(*pulseTrg); ok && pt.width < time.Duration(post+1)*time.Second {
+		return pt.width
+	}
+	return time.Duration(post+1) * time.Second
+}
+
+// pulse : pulse schedule at the ON time, there is no OFF time for a pulse
+func (jrs *JSONRelayState) pulse(loc *time.Location) (Schedule, error) {
+	if jrs.Primary {
+		return nil, fmt.Errorf("Pulse schedules can only be patch schedules, cannot be primary")
+	}
+	if jrs.OFF != "" {
+		return nil, fmt.Errorf("Pulse schedules have only an ON time, OFF %s is not needed", jrs.OFF)
+	}
+	width, err := time.ParseDuration(jrs.Pulse)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read width of the pulse for schedule: %s", err)
+	}
+	secs, err := TimeStr(jrs.ON).ToElapsedTm()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read ON time for schedule: %s", err)
+	}
+	trg, err := NewPulseTrg(secs, width, jrs.IDs...)
+	if err != nil {
+		return nil, err
+	}
+	return NewPulseSchedule(trg)
+}
@@ -0,0 +1,81 @@
+package scheduling
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPulse : pulses send both the edges, the falling one after just the width, and clash with schedules holding the same relays
+func TestPulse(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, TZ: "UTC", Primary: true},
+		{ON: "07:00 AM", IDs: []string{"GATE"}, TZ: "UTC", Pulse: "500ms"},
+		{ON: "08:00 PM", IDs: []string{"IN1"}, TZ: "UTC", Pulse: "500ms"},
+		{ON: "07:00 AM", IDs: []string{"GATE"}, TZ: "UTC", Pulse: "300ms"},
+		{ON: "07:00 PM", IDs: []string{"GATE"}, TZ: "UTC", Pulse: "1s"},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	gate := scheds[1]
+	assert.Equal(t, "07:00 AM [GATE] pulse 500ms ", fmt.Sprintf("%s", gate))
+
+	// IN1 is held by the primary, and the gate is pulsed twice at once
+	report := ConflictsIn(scheds)
+	assert.Equal(t, 2, len(report))
+	assert.Equal(t, ConflictPulse, report[0].Kind)
+	assert.True(t, scheds[0] == report[0].With)
+	assert.True(t, scheds[2] == report[0].Schedule)
+	assert.Equal(t, 72000, report[0].From)
+	assert.True(t, gate == report[1].With)
+	assert.True(t, scheds[3] == report[1].Schedule)
+	assert.Equal(t, 0, scheds[4].Conflicts())
+
+	// a pulse still high when a patch on the same relay opens would cut the patch short as it falls
+	edges := SliceOfJSONRelayState{
+		{ON: "08:00 AM", OFF: "09:00 AM", IDs: []string{"DOOR"}, TZ: "UTC"},
+		{ON: "07:59:59 AM", IDs: []string{"DOOR"}, TZ: "UTC", Pulse: "5s"},
+		{ON: "07:59:50 AM", IDs: []string{"DOOR"}, TZ: "UTC", Pulse: "5s"},
+	}
+	edged := []Schedule{}
+	assert.Nil(t, edges.ToSchedules(&edged))
+	assert.Equal(t, 1, edged[1].Conflicts(), "Pulse falls after the patch opens")
+	assert.Equal(t, 0, edged[2].Conflicts(), "Pulse is over before the patch opens")
+
+	from := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	trans := gate.Transitions(from, from.Add(24*time.Hour))
+	assert.Equal(t, 2, len(trans))
+	assert.Equal(t, time.Date(2021, 8, 1, 7, 0, 0, 0, time.UTC), trans[0].At)
+	assert.Equal(t, time.Date(2021, 8, 1, 7, 0, 0, int(500*time.Millisecond), time.UTC), trans[1].At)
+	assert.Equal(t, map[string]byte{"GATE": 0}, trans[1].Trigger.States())
+	assert.True(t, trans[1].Closes)
+
+	fc := NewFakeClock(time.Date(2021, 8, 1, 6, 59, 0, 0, time.UTC))
+	send := make(chan []byte)
+	msgs := collectSends(send)
+	done := make(chan error)
+	go func() {
+		done <- ApplyContext(context.Background(), gate, fc, send)
+	}()
+	fc.BlockUntil(1)
+	fc.AdvanceToNext()
+	fc.BlockUntil(1)
+	assert.Equal(t, 500*time.Millisecond, fc.AdvanceToNext(), "Falling edge was expected after the width of the pulse")
+	assert.Nil(t, <-done)
+	assert.Equal(t, []string{`{"GATE":1}`, `{"GATE":0}`}, msgs())
+
+	bad := []JSONRelayState{
+		{ON: "07:00 AM", OFF: "07:01 AM", IDs: []string{"GATE"}, Pulse: "500ms"},
+		{ON: "07:00 AM", IDs: []string{"GATE"}, Pulse: "0s"},
+		{ON: "07:00 AM", IDs: []string{"GATE"}, Pulse: "500"},
+		{ON: "07:00 AM", IDs: []string{"GATE"}, Pulse: "500ms", Primary: true},
+		{ON: "07:00 AM", Pulse: "500ms"},
+	}
+	for _, b := range bad {
+		_, err := b.ToSchedule()
+		assert.NotNil(t, err, "Was expecting an error for %v", b)
+	}
+}
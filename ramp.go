@@ -0,0 +1,98 @@
+package scheduling
+
+import (
+	"fmt"
+	"time"
+)
+
+// rampSchedule : patch that fades the levels of its relays rather than switching them, as for dimmers
+// From the ON trigger the levels go up in steps over the ramp, and from the OFF trigger they go back down over the ramp
+// Its a sequence of all the steps of both the ramps, it closes when the ramp down is over
+type rampSchedule struct {
+	*sequenceSchedule
+	opens, closes Trigger
+	ramp          time.Duration
+}
+
+// rampSteps : steps from the levels of one trigger to those of the other, evenly spaced over the ramp from the time of to
+// there is a step for every level of change, but not more than one a second
+func rampSteps(from, to Trigger, ramp time.Duration) []Trigger {
+	fromLvl, toLvl := from.States(), to.States()
+	n := 1
+	for id, lvl := range toLvl {
+		if d := int(lvl) - int(fromLvl[id]); d > n {
+			n = d
+		} else if -d > n {
+			n = -d
+		}
+	}
+	secs := ceilSeconds(ramp)
+	if n > secs {
+		n = secs
+	}
+	result := []Trigger{}
+	for i := 0; i <= n; i++ {
+		states := []*RelayState{}
+		for _, id := range to.RelayIDs() {
+			d := int(toLvl[id]) - int(fromLvl[id])
+			states = append(states, NewRelayLevel(id, byte(int(fromLvl[id])+d*i/n)))
+		}
+		result = append(result, NewTrg(to.At()+secs*i/n, states...))
+	}
+	return result
+}
+
+// NewRampSchedule : patch from opens till closes, whose levels fade in and out over the ramp
+// The ramp up has to be over before closes, and the ramp down before midnight, ramps cannot wrap past midnight
+func NewRampSchedule(opens, closes Trigger, ramp time.Duration) (Schedule, error) {
+	if opens == nil || closes == nil {
+		return nil, fmt.Errorf("triggers of a ramp schedule cannot be nil")
+	}
+	for _, trg := range []Trigger{opens, closes} {
+		switch trg.(type) {
+		case *cronTrg, *solarTrg:
+			return nil, fmt.Errorf("%s ramps can only be from clock times", trg)
+		}
+	}
+	if !opens.Intersects(closes, true) || opens.Coincides(closes) {
+		return nil, fmt.Errorf("%s-%s Triggers for the schedule are either not exactly intersecting or are coinciding", opens, closes)
+	}
+	secs := ceilSeconds(ramp)
+	if secs < 1 {
+		return nil, fmt.Errorf("%s ramp has to be at least a second", ramp)
+	}
+	if closes.At() <= opens.At()+secs || closes.At()+secs >= 86400 {
+		return nil, fmt.Errorf("%s-%s ramp of %s has to be over before the patch closes, and before midnight", opens, closes, ramp)
+	}
+	steps := rampSteps(closes, opens, ramp)
+	steps = append(steps, rampSteps(opens, closes, ramp)...)
+	seq, err := NewSequenceSchedule(steps...)
+	if err != nil {
+		return nil, err
+	}
+	rs := &rampSchedule{sequenceSchedule: seq.(*sequenceSchedule), opens: opens, closes: closes, ramp: ramp}
+	return rs.own(rs), nil
+}
+
+func (rs *rampSchedule) String() string {
+	return fmt.Sprintf("%s - %s %v ramp %s ", TmStrFromUnixSecs(rs.opens.At()), TmStrFromUnixSecs(rs.closes.At()), rs.opens.RelayIDs(), rs.ramp)
+}
+
+// ramp : patch schedule that fades in at ON and fades out at OFF
+func (jrs *JSONRelayState) ramp(ons, offs []*RelayState, loc *time.Location) (Schedule, error) {
+	if jrs.Primary {
+		return nil, fmt.Errorf("Ramps are only for patch schedules, cannot be primary")
+	}
+	if IsCron(jrs.ON) || IsCron(jrs.OFF) {
+		return nil, fmt.Errorf("Ramps cannot be on cron expressions")
+	}
+	ramp, err := time.ParseDuration(jrs.Ramp)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read ramp for schedule: %s", err)
+	}
+	on, off, err := jrs.triggers(ons, offs, loc)
+	if err != nil {
+		return nil, err
+	}
+	return NewRampSchedule(on, off, ramp)
+}
@@ -0,0 +1,72 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLevels : relays set to levels, and patches that fade their levels in and out
+func TestLevels(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"FAN"}, TZ: "UTC", Primary: true, Level: 3},
+		{ON: "07:00 PM", OFF: "11:00 PM", IDs: []string{"LED1"}, TZ: "UTC", Level: 60, Ramp: "30m"},
+		{TZ: "UTC", Steps: []JSONStep{
+			{At: "05:00 AM", Levels: map[string]int{"VALVE": 50}},
+			{At: "05:10 AM", Levels: map[string]int{"VALVE": 100}},
+			{At: "05:20 AM", OFF: []string{"VALVE"}},
+		}},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	dimmer := scheds[1]
+	assert.Equal(t, 0, len(ConflictsIn(scheds)))
+	assert.Equal(t, "07:00 PM - 11:00 PM [LED1] ramp 30m0s ", fmt.Sprintf("%s", dimmer))
+
+	from := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	trans := dimmer.Transitions(from, from.Add(24*time.Hour))
+	assert.Equal(t, 122, len(trans), "A step for every level up and down")
+	assert.Equal(t, time.Date(2021, 8, 1, 19, 15, 0, 0, time.UTC), trans[30].At)
+	byt, err := json.Marshal(trans[30].Trigger)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"LED1":30}`, string(byt))
+	assert.Equal(t, byte(60), trans[60].Trigger.States()["LED1"])
+	assert.Equal(t, time.Date(2021, 8, 1, 23, 0, 0, 0, time.UTC), trans[61].At)
+	assert.Equal(t, time.Date(2021, 8, 1, 23, 30, 0, 0, time.UTC), trans[121].At)
+	assert.Equal(t, byte(0), trans[121].Trigger.States()["LED1"])
+	assert.True(t, trans[121].Closes)
+
+	states := StateAt(scheds, time.Date(2021, 8, 1, 23, 15, 10, 0, time.UTC))
+	assert.Equal(t, byte(30), states["LED1"].State)
+	assert.Equal(t, byte(3), states["FAN"].State)
+	assert.True(t, strings.HasPrefix(states["FAN"].String(), "FAN at 3 by"))
+	states = StateAt(scheds, time.Date(2021, 8, 1, 5, 15, 0, 0, time.UTC))
+	assert.Equal(t, byte(100), states["VALVE"].State)
+
+	rs := NewRelayLevel("LED1", 40)
+	assert.Equal(t, byte(40), rs.Level())
+	rs.Flip()
+	assert.Equal(t, byte(0), rs.Level())
+	rs.Flip()
+	assert.Equal(t, byte(1), rs.Level())
+	assert.Equal(t, byte(20), rs.State(20).Level())
+
+	bad := []JSONRelayState{
+		{ON: "06:00 PM", OFF: "11:00 PM", IDs: []string{"LED1"}, Level: 300},
+		{ON: "06:00 PM", OFF: "11:00 PM", IDs: []string{"LED1"}, Level: 60, Ramp: "30m", Primary: true},
+		{ON: "06:00 PM", OFF: "06:20 PM", IDs: []string{"LED1"}, Level: 60, Ramp: "30m"},
+		{ON: "06:00 PM", OFF: "11:50 PM", IDs: []string{"LED1"}, Level: 60, Ramp: "30m"},
+		{ON: "06:00 PM", OFF: "11:00 PM", IDs: []string{"LED1"}, Level: 60, Ramp: "30"},
+		{ON: "06:00 PM", OFF: "11:00 PM", IDs: []string{"LED1"}, Level: 60, Ramp: "30m", Jitter: "10m"},
+		{ON: "06:00 PM", OFF: "11:00 PM", IDs: []string{"LED1"}, Level: 60, Ramp: "30m", Pulse: "5s"},
+		{ON: "06:00 PM", OFF: "11:00 PM", IDs: []string{"LED1"}, Level: 60, Ramp: "30m", Cycle: &JSONCycle{ON: "10m", OFF: "50m"}},
+	}
+	for _, b := range bad {
+		_, err := b.ToSchedule()
+		assert.NotNil(t, err, "Was expecting an error for %v", b)
+	}
+}
@@ -0,0 +1,250 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Diff : how a new set of schedules differs from the one running
+type Diff struct {
+	Added   []Schedule
+	Removed []Schedule
+	// Modified : schedules on the same relays and of the same type that have changed, the running ones and what replaces them
+	Modified [][2]Schedule
+	// Unchanged : the running schedules that are the same in the new set, these are left as they are
+	Unchanged []Schedule
+}
+
+// Empty : true if there is nothing to restart
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+func (d Diff) String() string {
+	return fmt.Sprintf("%d added, %d removed, %d modified, %d unchanged", len(d.Added), len(d.Removed), len(d.Modified), len(d.Unchanged))
+}
+
+// fingerprint : everything about the schedule that defines how its run, 2 schedules with the same fingerprint behave the same
+// its only what the schedule is read from, not the delay that depends on the other schedules in the file
+// nor the time solar triggers resolve to on the day they were read
+func fingerprint(sch Schedule) string {
+	lw, hg := sch.Triggers()
+	result := fmt.Sprintf("%T|%s|%s|%s|%s|%s|%d", sch, triggerKey(lw), triggerKey(hg), sch.Location(), sch.Calendar(), sch.Lifetime(), sch.Priority())
+	if js, ok := sch.(*jitterSchedule); ok {
+		// the widened triggers are the same for any seed
+		result = fmt.Sprintf("%s|%s|%s|%s|%d", result, triggerKey(js.opens), triggerKey(js.closes), js.window, js.seed)
+	}
+	if seq, ok := sch.(stepped); ok {
+		// sequences with the same first and last steps could differ in the steps between
+		for _, step := range seq.stepList() {
+			result = fmt.Sprintf("%s|%s", result, triggerKey(step))
+		}
+	}
+	return result
+}
+
+// triggerKey : what the trigger is read from and the states it sets
+// solar triggers by their event, offset and place, cron triggers by their expression and the rest by the time of the day
+func triggerKey(trg Trigger) string {
+	states, _ := json.Marshal(trg)
+	switch t := trg.(type) {
+	case *solarTrg:
+		return fmt.Sprintf("%s%+d@%f,%f%s", t.event, t.offset, t.lat, t.lon, states)
+	case *cronTrg:
+		return fmt.Sprintf("cron(%s)%s", t.expr, states)
+	case *pulseTrg:
+		return fmt.Sprintf("%d+%s%s", t.At(), t.width, states)
+	}
+	return fmt.Sprintf("%d%s", trg.At(), states)
+}
+
+// identity : schedules with the same identity in the old and the new set are thought of as modified, rather than removed and added
+func identity(sch Schedule) string {
+	lw, _ := sch.Triggers()
+	return fmt.Sprintf("%T|%v", sch, lw.RelayIDs())
+}
+
+// DiffSchedules : compares the running schedules with the new ones
+// Schedules are matched by their fingerprint, so the running ones that are unchanged keep their runs and are not restarted
+func DiffSchedules(running, next []Schedule) Diff {
+	diff := Diff{}
+	unmatched := map[string][]Schedule{}
+	for _, sch := range running {
+		fp := fingerprint(sch)
+		unmatched[fp] = append(unmatched[fp], sch)
+	}
+	added := []Schedule{}
+	for _, sch := range next {
+		fp := fingerprint(sch)
+		if same := unmatched[fp]; len(same) > 0 {
+			diff.Unchanged = append(diff.Unchanged, same[0])
+			unmatched[fp] = same[1:]
+			continue
+		}
+		added = append(added, sch)
+	}
+	removed := []Schedule{}
+	for _, sch := range running {
+		for _, left := range unmatched[fingerprint(sch)] {
+			if left == sch {
+				removed = append(removed, sch)
+				break
+			}
+		}
+	}
+	// added and removed with the same identity pair up, in the order they are in the sets
+	for _, sch := range added {
+		paired := false
+		for i, old := range removed {
+			if identity(old) == identity(sch) {
+				diff.Modified = append(diff.Modified, [2]Schedule{old, sch})
+				removed = append(removed[:i], removed[i+1:]...)
+				paired = true
+				break
+			}
+		}
+		if !paired {
+			diff.Added = append(diff.Added, sch)
+		}
+	}
+	diff.Removed = removed
+	return diff
+}
+
+// Watcher : keeps the schedules on an engine in sync with the schedule file
+// When the file changes its read again, and only the schedules that were added, removed or modified are restarted on the engine
+// A file that cannot be read, has conflicting schedules or ones against its interlocks or protections is rejected as a whole, and the schedules running are left as they are
+// The interlocks and protections of the file are enforced on the engine from when its read
+type Watcher struct {
+	file    string
+	eng     *Engine
+	mu      sync.Mutex
+	running []Schedule
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher : reads the schedule file and adds its schedules to the engine
+func NewWatcher(file string, eng *Engine) (*Watcher, error) {
+	w := &Watcher{file: file, eng: eng}
+	if _, err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Schedules : schedules from the file that are running on the engine
+func (w *Watcher) Schedules() []Schedule {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Schedule{}, w.running...)
+}
+
+// validSchedules : reads the schedule file, its interlocks and protections, errors out if it cannot be read or any of its schedules conflict
+// the schedules are checked against the interlocks and protections over the week from the day of at
+func validSchedules(file string, at time.Time) ([]Schedule, []Interlock, []Protection, error) {
+	sf, scheds, err := readScheduleFile(file, at)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if report := ConflictsIn(scheds); len(report) > 0 {
+		return nil, nil, nil, fmt.Errorf("%d conflicts, %s", len(report), report[0])
+	}
+	locks, err := sf.ToInterlocks()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	prots, err := sf.ToProtections()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return scheds, locks, prots, nil
+}
+
+// Reload : reads the file again and reconciles the engine with it, whether or not the file has changed
+func (w *Watcher) Reload() (Diff, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	info, err := os.Stat(w.file)
+	if err != nil {
+		return Diff{}, fmt.Errorf("Watcher/Reload: %s", err)
+	}
+	// even when rejected, the same contents are not read again till they change
+	w.modTime, w.size = info.ModTime(), info.Size()
+	next, locks, prots, err := validSchedules(w.file, w.eng.clk.Now())
+	if err != nil {
+		return Diff{}, fmt.Errorf("Watcher/Reload: rejected %s - %s", w.file, err)
+	}
+	w.eng.Interlock(locks...)
+	w.eng.Protect(prots...)
+	diff := DiffSchedules(w.running, next)
+	for _, sch := range diff.Removed {
+		w.eng.Remove(sch)
+	}
+	for _, pair := range diff.Modified {
+		w.eng.Remove(pair[0])
+		w.eng.Add(pair[1])
+	}
+	w.eng.Add(diff.Added...)
+	w.running = append([]Schedule{}, diff.Unchanged...)
+	for _, pair := range diff.Modified {
+		w.running = append(w.running, pair[1])
+	}
+	w.running = append(w.running, diff.Added...)
+	return diff, nil
+}
+
+// changed : true if the file has changed since it was last read
+func (w *Watcher) changed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	info, err := os.Stat(w.file)
+	if err != nil {
+		return false
+	}
+	return !info.ModTime().Equal(w.modTime) || info.Size() != w.size
+}
+
+// Watch : checks the file for changes every interval on the clock, till stop is closed
+// the diff of every reload goes out on diffs and errors rejecting the file on errx, either if nil are just logged
+func (w *Watcher) Watch(clk Clock, interval time.Duration, stop chan interface{}, diffs chan Diff, errx chan error) {
+	if clk == nil {
+		clk = RealClock
+	}
+	for {
+		timer := clk.NewTimer(interval)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		if !w.changed() {
+			continue
+		}
+		diff, err := w.Reload()
+		switch {
+		case err != nil && errx != nil:
+			select {
+			case errx <- err:
+			case <-stop:
+				return
+			}
+		case err != nil:
+			log.Error(err)
+		case diffs != nil:
+			select {
+			case diffs <- diff:
+			case <-stop:
+				return
+			}
+		default:
+			log.Infof("Watcher: %s reloaded, %s", w.file, diff)
+		}
+	}
+}
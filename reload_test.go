@@ -0,0 +1,124 @@
+package scheduling
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReload : only the schedules that change in the file are restarted, and a bad file is rejected as a whole
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scheduling")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "schedules.json")
+	write := func(sojrs SliceOfJSONRelayState, age time.Duration) {
+		assert.Nil(t, WriteFile(file, &ScheduleFile{TZ: "UTC", Schedules: sojrs}))
+		// file times are not always fine enough to tell apart writes in quick succession
+		mod := time.Now().Add(-age)
+		assert.Nil(t, os.Chtimes(file, mod, mod))
+	}
+	write(SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, Primary: true},
+		{ON: "04:30 PM", OFF: "06:00 PM", IDs: []string{"IN1"}},
+		{ON: "09:00 PM", OFF: "10:00 PM", IDs: []string{"IN3"}},
+	}, time.Hour)
+	fc := NewFakeClock(time.Date(2021, 8, 1, 17, 0, 0, 0, time.UTC))
+	eng := NewEngine(fc, nil, nil, nil)
+	w, err := NewWatcher(file, eng)
+	assert.Nil(t, err)
+	before := w.Schedules()
+	assert.Equal(t, 3, len(before))
+	assert.Equal(t, 3, len(eng.Schedules()))
+
+	// primary is the same, the patch on IN1 is moved, the one on IN3 is dropped and one on IN4 is new
+	write(SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, Primary: true},
+		{ON: "05:00 PM", OFF: "06:00 PM", IDs: []string{"IN1"}},
+		{ON: "09:00 PM", OFF: "10:00 PM", IDs: []string{"IN4"}},
+	}, 30*time.Minute)
+	diff, err := w.Reload()
+	assert.Nil(t, err)
+	assert.Equal(t, "1 added, 1 removed, 1 modified, 1 unchanged", diff.String())
+	assert.True(t, before[0] == diff.Unchanged[0], "Unchanged schedule should not have been restarted")
+	assert.True(t, before[1] == diff.Modified[0][0])
+	assert.True(t, before[2] == diff.Removed[0])
+	assert.Equal(t, 3, len(eng.Schedules()))
+	assert.True(t, DiffSchedules(w.Schedules(), w.Schedules()).Empty())
+
+	// neither the delay from the other schedules, nor the day solar triggers were resolved on, make a schedule modified
+	lat, lon := 28.6139, 77.2090
+	solar := SliceOfJSONRelayState{{ON: "sunset+00:10", OFF: "sunrise-00:15", IDs: []string{"IN1"}, Primary: true, TZ: "UTC", Lat: &lat, Lon: &lon}}
+	today, tomorrow := []Schedule{}, []Schedule{}
+	assert.Nil(t, solar.ToSchedules(&today))
+	assert.Nil(t, solar.ToSchedules(&tomorrow))
+	lw, hg := tomorrow[0].Triggers()
+	for _, trg := range []Trigger{lw, hg} {
+		assert.Nil(t, trg.(*solarTrg).ResolveOn(time.Date(2021, 12, 21, 0, 0, 0, 0, time.UTC), time.UTC))
+	}
+	tomorrow[0].AddDelay(5)
+	assert.True(t, DiffSchedules(today, tomorrow).Empty())
+	solar[0].ON = "sunset+00:20"
+	assert.Nil(t, solar.ToSchedules(&tomorrow))
+	assert.Equal(t, "0 added, 0 removed, 1 modified, 0 unchanged", DiffSchedules(today, tomorrow).String())
+
+	// conflicting patches on IN1, and then a half written file, are both rejected leaving the schedules as they are
+	running := w.Schedules()
+	write(SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, Primary: true},
+		{ON: "05:00 PM", OFF: "06:00 PM", IDs: []string{"IN1"}},
+		{ON: "05:30 PM", OFF: "06:15 PM", IDs: []string{"IN1"}},
+	}, 20*time.Minute)
+	_, err = w.Reload()
+	assert.NotNil(t, err, "Was expecting conflicting schedules to be rejected")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"tz":"UTC", "schedules": [{"on":"06:30 PM"`), 0644))
+	_, err = w.Reload()
+	assert.NotNil(t, err, "Was expecting a half written file to be rejected")
+	assert.Equal(t, running, w.Schedules())
+
+	// watching the file, changes are picked up on the next tick of the clock
+	stop, diffs, errx := make(chan interface{}), make(chan Diff, 1), make(chan error, 1)
+	defer close(stop)
+	go w.Watch(fc, time.Minute, stop, diffs, errx)
+	write(SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, Primary: true},
+	}, 10*time.Minute)
+	fc.BlockUntil(1)
+	fc.Advance(time.Minute)
+	select {
+	case diff := <-diffs:
+		assert.Equal(t, "0 added, 2 removed, 0 modified, 1 unchanged", diff.String())
+	case err := <-errx:
+		t.Error(err)
+	case <-time.After(time.Second):
+		t.Error("Was expecting the change in the file to be picked up")
+	}
+	assert.Equal(t, 1, len(eng.Schedules()))
+
+	// a patch removed while its in effect lets go of its relay right away
+	write(SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, Primary: true},
+		{ON: "09:00 PM", OFF: "10:00 PM", IDs: []string{"IN3"}},
+	}, 5*time.Minute)
+	fc = NewFakeClock(time.Date(2021, 8, 1, 21, 30, 0, 0, time.UTC))
+	send := make(chan []byte)
+	eng = NewEngine(fc, send, nil, nil)
+	w, err = NewWatcher(file, eng)
+	assert.Nil(t, err)
+	stopEng := make(chan interface{})
+	defer close(stopEng)
+	go eng.Run(stopEng)
+	assert.Equal(t, `{"IN1":1,"IN2":1}`, string(<-send))
+	assert.Equal(t, `{"IN3":1}`, string(<-send))
+	write(SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, Primary: true},
+	}, 4*time.Minute)
+	diff, err = w.Reload()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(diff.Removed))
+	assert.Equal(t, `{"IN3":0}`, string(<-send))
+}
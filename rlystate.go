@@ -3,6 +3,7 @@ package scheduling
 // RelayState : this is just to hold the state of relay with the identification of the relay
 // relay should be identified with the same name as required by srvrelay
 // Storing this as just a byte is also possible, but that is when we want the relay module to work as a block, not when we want to operate on individual relays
+// state is 0 or 1 for relays that switch, and a level upto MaxLevel for dimmers, fan speeds or valve positions
 type RelayState struct {
 	state byte
 	id    string
@@ -13,20 +14,29 @@ func (rs *RelayState) Status() map[string]byte {
 	return map[string]byte{rs.id: rs.state}
 }
 
-// Flip : flips the state of the relay
+// MaxLevel : highest level a relay state can have, levels are typically percentages or 8 bit PWM duties
+const MaxLevel = 255
+
+// Flip : flips the state of the relay, any level above 0 is ON and flips to OFF
 func (rs *RelayState) Flip() {
-	rs.state = byte(1) - rs.state
+	if rs.state > 0 {
+		rs.state = byte(0)
+		return
+	}
+	rs.state = byte(1)
 }
 
-// State : sets the state of the relay
+// State : sets the state of the relay, 0 or 1 for relays that switch or the level for those that dim
 func (rs *RelayState) State(new byte) *RelayState {
-	if new > 0 {
-		rs.state = byte(1)
-	}
-	rs.state = byte(0)
+	rs.state = new
 	return rs
 }
 
+// Level : state of the relay, which is the level for relays that dim
+func (rs *RelayState) Level() byte {
+	return rs.state
+}
+
 // ID : spits out the id of the relay state
 // this is generally the relay ID on the actual relay, IN1, IN2, IN3..
 func (rs *RelayState) ID() string {
@@ -37,3 +47,8 @@ func (rs *RelayState) ID() string {
 func NewRelayState(id string) *RelayState {
 	return &RelayState{byte(0), id}
 }
+
+// NewRelayLevel : relay state at a level, as for dimmers
+func NewRelayLevel(id string, level byte) *RelayState {
+	return &RelayState{level, id}
+}
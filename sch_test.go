@@ -2,7 +2,6 @@ package scheduling
 
 import (
 	"fmt"
-	"net"
 	"os"
 	"testing"
 	"time"
@@ -59,28 +58,40 @@ func TestScheduleConflicts(t *testing.T) {
 		}
 	}
 }
-func listenOnSend(t *testing.T, errx chan error, send chan []byte, cancel chan interface{}) {
-	for {
-		select {
-		case <-time.After(1 * time.Second):
-			continue
-		case err := <-errx:
-			t.Errorf("Error from shcedule application %s", err)
-		case msg := <-send:
-			conn, err := net.Dial("tcp", fmt.Sprintf("%s:%s", "localhost", "35001"))
-			if err != nil {
-				t.Errorf("Failed to connect to socket over TCP %s", err)
-			}
-			_, err = conn.Write(msg)
-			if err != nil {
-				t.Errorf("Error writing message to TCP sock %s", err)
+
+// collectSends : drains the send channel so that schedules under test never block on it
+// call the returned function to stop collecting and get all the messages sent so far
+func collectSends(send chan []byte) func() []string {
+	result := make(chan []string)
+	cancel := make(chan interface{})
+	go func() {
+		msgs := []string{}
+		for {
+			select {
+			case msg := <-send:
+				msgs = append(msgs, string(msg))
+			case <-cancel:
+				result <- msgs
+				return
 			}
-			conn.Close()
-		case <-cancel:
-			return
 		}
+	}()
+	return func() []string {
+		close(cancel)
+		return <-result
 	}
 }
+
+// advanceDay : steps the fake clock from one timer to the next till a day and a bit has passed
+// waiting each time for all the n routines to be sleeping on the clock
+func advanceDay(fc *FakeClock, n int) {
+	start := fc.Now()
+	for fc.Now().Sub(start) < 25*time.Hour {
+		fc.BlockUntil(n)
+		fc.AdvanceToNext()
+	}
+}
+
 func TestScheduleApply(t *testing.T) {
 	scheds, err := ReadScheduleFile("test_sched3.json")
 	if err != nil {
@@ -92,24 +103,37 @@ func TestScheduleApply(t *testing.T) {
 	}
 	stop := make(chan interface{})
 	send := make(chan []byte)
-	errx := make(chan error)
+	errx := make(chan error, 10)
 	defer close(stop)
-	defer close(errx)
-	defer close(send)
-	// Send channel here is nil since we just want to log the tcp messages
-	// we may write more code to get the messages across TCP
+	msgs := collectSends(send)
+	fc := NewFakeClock(time.Date(2021, 8, 1, 17, 0, 0, 0, time.Local))
+	// Each of the schedules is applied for one cycle in turn, the clock is moved past its pre sleep if any and then its post sleep
+	applied := 0
 	for _, s := range scheds {
-		if s.Conflicts() == 0 {
-			call, _ := Apply(s, stop, send, errx)
-			go call()
-		} else {
+		if s.Conflicts() > 0 {
 			t.Logf("%s has %d conflicts \n", s, s.Conflicts())
+			continue
+		}
+		_, _, pre, _ := s.ToTaskAt(fc.Now())
+		call, ok := ApplyWithClock(s, fc, stop, send, errx)
+		go call()
+		sleeps := 1
+		if pre > 0 {
+			sleeps++
 		}
+		for i := 0; i < sleeps; i++ {
+			fc.BlockUntil(1)
+			fc.AdvanceToNext()
+		}
+		<-ok
+		applied++
+	}
+	assert.Equal(t, 0, len(errx), "Unexpected errors applying schedules")
+	sent := msgs()
+	assert.Equal(t, 2*applied, len(sent), "Each applied schedule was expected to send 2 states")
+	for _, m := range sent {
+		t.Logf("TCP: %s", m)
 	}
-	go listenOnSend(t, errx, send, stop)
-	<-time.After(60 * time.Minute)
-	t.Log("Now closing the context..")
-	// this closes the schedule context and hence all the tasks
 }
 
 func TestScheduleLoop(t *testing.T) {
@@ -124,20 +148,33 @@ func TestScheduleLoop(t *testing.T) {
 	stop := make(chan interface{})
 	interrupt := make(chan interface{})
 	send := make(chan []byte)
-	errx := make(chan error)
+	errx := make(chan error, 10)
 	defer close(stop)
-	defer close(interrupt)
-	defer close(errx)
-	defer close(send)
+	msgs := collectSends(send)
+	fc := NewFakeClock(time.Date(2021, 8, 1, 17, 0, 0, 0, time.Local))
+	running := 0
 	for _, s := range scheds {
 		if s.Conflicts() == 0 {
-			go Loop(s, stop, interrupt, send, errx)
+			go LoopWithClock(s, fc, stop, interrupt, send, errx)
+			running++
 		} else {
 			t.Logf("%s has %d conflicts \n", s, s.Conflicts())
 		}
 	}
-	go listenOnSend(t, errx, send, stop)
-	<-time.After(9999 * time.Second)
+	advanceDay(fc, running)
+	// cancelled, the loop exits without waiting on the schedule
+	cancelled, done := make(chan interface{}), make(chan struct{})
+	go func() {
+		LoopWithClock(scheds[0], fc, cancelled, make(chan interface{}), send, errx)
+		close(done)
+	}()
+	close(cancelled)
+	<-done
+	close(interrupt)
+	assert.Equal(t, 0, len(errx), "Unexpected errors looping schedules")
+	sent := msgs()
+	// over a day each schedule sends atleast its 2 states
+	assert.True(t, len(sent) >= 2*running, "Too few states sent over a day")
 	t.Log("Now closing the test..")
 }
 
@@ -182,3 +219,79 @@ func TestToSchedules(t *testing.T) {
 		t.Logf("%v:%d", s, s.Conflicts())
 	}
 }
+
+// TestTimeZoneSchedules : trigger times are read on the wall clock of the schedule's zone and not that of the host
+func TestTimeZoneSchedules(t *testing.T) {
+	sf := ScheduleFile{
+		TZ: "Asia/Kolkata",
+		Schedules: SliceOfJSONRelayState{
+			{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, Primary: true},
+			{ON: "04:30 PM", OFF: "06:13 PM", IDs: []string{"IN3"}, Primary: false, TZ: "UTC"},
+		},
+	}
+	scheds := []Schedule{}
+	err := sf.ToSchedules(&scheds)
+	assert.Nil(t, err, "Unexpected error converting schedules with time zones")
+	if err != nil {
+		return
+	}
+	assert.Equal(t, "Asia/Kolkata", scheds[0].Location().String())
+	assert.Equal(t, "UTC", scheds[1].Location().String())
+	// 12:30 UTC is 06:00 PM in India, half an hour before the lights go ON
+	now := time.Date(2021, 8, 1, 12, 30, 0, 0, time.UTC)
+	nr, fr, pre, post := scheds[0].ToTaskAt(now)
+	assert.Equal(t, 6*3600+30*60, nr.At(), "Near trigger should have been the OFF trigger at 06:30 AM")
+	assert.Equal(t, 18*3600+30*60, fr.At(), "Far trigger should have been the ON trigger at 06:30 PM")
+	assert.Equal(t, 0, pre)
+	assert.Equal(t, 1800, post)
+	// while for the patch in UTC, 12:30 is 4 hours before it starts
+	_, _, pre, post = scheds[1].ToTaskAt(now)
+	assert.Equal(t, 4*3600+scheds[1].Delay(), pre)
+	assert.Equal(t, 6180, post)
+
+	sf.TZ = "Mars/Olympus_Mons"
+	assert.NotNil(t, sf.ToSchedules(&scheds), "Was expecting an error for a zone that does not exist")
+}
+
+// TestExpiringSchedules : loops exit on their own, with an event, once the schedule has run its lifetime
+func TestExpiringSchedules(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "11:30 PM", IDs: []string{"IN1"}, TZ: "UTC", Once: true},
+		{ON: "06:30 AM", OFF: "07:30 AM", IDs: []string{"IN2"}, TZ: "UTC", Runs: 3},
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN3"}, TZ: "UTC", Primary: true, Expires: "2021-08-03 08:00"},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	assert.Equal(t, "2021-08-03T08:00:00Z", scheds[2].Lifetime().Expires.Format(time.RFC3339))
+	_, err := NewLifetime(true, 2, "", time.UTC)
+	assert.NotNil(t, err, "Schedule cannot be once and run twice")
+
+	fc := NewFakeClock(time.Date(2021, 8, 1, 17, 0, 0, 0, time.UTC))
+	cancel, interrupt := make(chan interface{}), make(chan interface{})
+	defer close(interrupt)
+	send, errx, events := make(chan []byte), make(chan error, 10), make(chan Event, 10)
+	msgs := collectSends(send)
+	for _, s := range scheds {
+		go LoopWithEvents(s, fc, cancel, interrupt, send, errx, events)
+	}
+	expired := map[string]time.Time{}
+	for len(expired) < len(scheds) {
+		select {
+		case ev := <-events:
+			assert.Equal(t, EventExpired, ev.Kind)
+			expired[ev.Schedule] = ev.At
+		case <-time.After(10 * time.Millisecond):
+			fc.AdvanceToNext()
+		}
+	}
+	assert.Equal(t, 0, len(errx))
+	assert.Equal(t, 1, scheds[0].Runs())
+	assert.Equal(t, 3, scheds[1].Runs())
+	// tonight only : 06:30 PM ON and 11:30 PM OFF
+	assert.Equal(t, time.Date(2021, 8, 1, 23, 30, 1, 0, time.UTC), expired[fmt.Sprintf("%s", scheds[0])])
+	// third morning
+	assert.Equal(t, time.Date(2021, 8, 4, 7, 30, 1, 0, time.UTC), expired[fmt.Sprintf("%s", scheds[1])])
+	// primary does not start the cycle that would go past its expiry
+	assert.Equal(t, time.Date(2021, 8, 3, 6, 30, 1, 0, time.UTC), expired[fmt.Sprintf("%s", scheds[2])])
+	assert.Equal(t, 2*1+2*3+2*4, len(msgs()))
+}
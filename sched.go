@@ -9,6 +9,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -17,6 +20,8 @@ import (
 // Schedule : is the handle for external packages
 type Schedule interface {
 	Triggers() (Trigger, Trigger)
+	// Wraps : true for patch schedules that open on one day and close on the next, crossing midnight
+	Wraps() bool
 	Duration() int
 	ConflictsWith(another Schedule) bool
 	Midpoint() int
@@ -24,10 +29,43 @@ type Schedule interface {
 	AddDelay(prior int) Schedule
 	Conflicts() int
 	AddConflict() Schedule
+	// Priority : of the schedules in effect on a relay the one with the highest priority wins, see PriorityBase
+	Priority() int
+	WithPriority(p int) Schedule
+	// Clashes : why the schedule is in conflict, with which schedule and on what relays
+	Clashes() ConflictReport
+	AddClash(c Conflict) Schedule
 	Close()
 	ToTask() (Trigger, Trigger, int, int)
+	ToTaskAt(now time.Time) (Trigger, Trigger, int, int)
+	// Transitions : triggers of the schedule pinned to real instants, from (inclusive) till to (exclusive) in order of time
+	Transitions(from, to time.Time) []Transition
+	// Location : time zone in which the schedule reads its trigger times
+	Location() *time.Location
+	InLocation(loc *time.Location) Schedule
+	// Calendar : days on which the schedule is in effect
+	Calendar() Calendar
+	OnCalendar(cal Calendar) Schedule
+	// Lifetime : how long the schedule lives, Expired when thats over given the cycles it has run
+	Lifetime() Lifetime
+	WithLifetime(lt Lifetime) Schedule
+	Runs() int
+	AddRun() Schedule
+	Expired(now time.Time) bool
 }
 
+// Priorities of schedules, from the base policy that applies unless overridden, to an emergency that overrides everything
+// Schedules are all PriorityBase unless given otherwise, where patches win over primary schedules as they always have
+// any other number works as well
+const (
+	PriorityBase        = 0
+	PriorityFloor       = 10
+	PriorityMaintenance = 20
+	PriorityEmergency   = 30
+	// PriorityManual : relays forced by hand win over all the schedules, see Engine.Override
+	PriorityManual = 40
+)
+
 func sortTriggers(trg1, trg2 Trigger) (l, h Trigger, e error) {
 	if trg1.At() == trg2.At() || trg1 == nil || trg2 == nil {
 		e = fmt.Errorf("ERROR/sortTriggers: triggers cannot be overlapping, or nil")
@@ -42,7 +80,16 @@ func sortTriggers(trg1, trg2 Trigger) (l, h Trigger, e error) {
 }
 
 // NewSchedule : makes a new TriggeredSchedul, will take 2 triggers
+// When both the triggers are cron triggers, trg1 opens and trg2 closes the schedule, and such schedules can only be patch
 func NewSchedule(trg1, trg2 Trigger, primary bool) (Schedule, error) {
+	on, onCron := trg1.(*cronTrg)
+	off, offCron := trg2.(*cronTrg)
+	if onCron || offCron {
+		if !onCron || !offCron || primary {
+			return nil, fmt.Errorf("%s-%s cron triggers can make only patch schedules and only with other cron triggers", trg1, trg2)
+		}
+		return newCronSchedule(on, off)
+	}
 	l, h, err := sortTriggers(trg1, trg2)
 	if err != nil {
 		return nil, err
@@ -54,14 +101,42 @@ func NewSchedule(trg1, trg2 Trigger, primary bool) (Schedule, error) {
 		return nil, fmt.Errorf("%s-%s Triggers for the schedule are either not exactly intersecting or are coinciding", trg1, trg2)
 	}
 	if primary {
-		return &primarySched{l, h, 0, 0}, nil
+		rest := []*RelayState{}
+		for _, id := range l.RelayIDs() {
+			rest = append(rest, NewRelayLevel(id, 0))
+		}
+		return &primarySched{lower: l, higher: h, loc: time.Local, cal: EveryDay, rest: NewTrg(0, rest...)}, nil
 	}
-	return &patchSchedule{&primarySched{l, h, 0, 0}}, nil
+	pas := &patchSchedule{primarySched: &primarySched{lower: l, higher: h, loc: time.Local, cal: EveryDay}}
+	return pas.own(pas), nil
 
 }
 
+// NewPatchSchedule : patch schedule that opens with one trigger and closes with the other
+// when the closing trigger is earlier in the day than the opening one, the patch wraps past midnight to close the next day
+// Cron triggers make a cron schedule as with NewSchedule
+func NewPatchSchedule(opens, closes Trigger) (Schedule, error) {
+	_, onCron := opens.(*cronTrg)
+	_, offCron := closes.(*cronTrg)
+	if onCron || offCron {
+		return NewSchedule(opens, closes, false)
+	}
+	sched, err := NewSchedule(opens, closes, false)
+	if err != nil {
+		return nil, err
+	}
+	pas := sched.(*patchSchedule)
+	pas.wraps = closes.At() < opens.At()
+	return pas, nil
+}
+
 // Apply : applies the schedule once for a cycle pre>state>post>state
 func Apply(sch Schedule, stop chan interface{}, send chan []byte, errx chan error) (func(), chan interface{}) {
+	return ApplyWithClock(sch, RealClock, stop, send, errx)
+}
+
+// ApplyWithClock : same as Apply, but all the time keeping and sleeping is on the clock given
+func ApplyWithClock(sch Schedule, clk Clock, stop chan interface{}, send chan []byte, errx chan error) (func(), chan interface{}) {
 	ok := make(chan interface{}, 1)
 	return func() {
 		defer close(ok)
@@ -75,11 +150,15 @@ func Apply(sch Schedule, stop chan interface{}, send chan []byte, errx chan erro
 			errx <- fmt.Errorf("Schedule/Apply: Null schedule, cannot apply")
 			return
 		}
-		nr, fr, pre, post := sch.ToTask()
+		nr, fr, pre, post := sch.ToTaskAt(clk.Now())
+		if nr == nil || fr == nil {
+			errx <- fmt.Errorf("Schedule/Apply: %s has no upcoming transitions, cannot apply", sch)
+			return
+		}
 		log.Debugf("Near: %s Far: %s Pre: %d Post: %d\n", nr, fr, pre, post)
 		if pre > 0 {
 			// this will work as expected even when pre=0, but the problem is it sill still allow the processor to jump to the next task
-			<-time.After(time.Duration(pre) * time.Duration(1*time.Second))
+			<-clk.After(time.Duration(pre) * time.Duration(1*time.Second))
 		}
 		byt, e := json.Marshal(nr)
 		if e != nil { // state of the trigger is applied
@@ -95,8 +174,8 @@ func Apply(sch Schedule, stop chan interface{}, send chan []byte, errx chan erro
 
 		select {
 		// sleep duration is always a second extra than the sleep time
-		// so that incase the processor is fast enough this will still be in the next slot
-		case <-time.After(time.Duration(post+1) * time.Duration(1*time.Second)):
+		// so that incase the processor is fast enough this will still be in the next slot, pulses fall after just their width
+		case <-clk.After(pulseAfter(nr, post)):
 			log.Info("End of post duration")
 			if byt, e = json.Marshal(fr); e != nil {
 				errx <- fmt.Errorf("Schedule/Apply: Failed to marshall trigger data - %s", e)
@@ -115,26 +194,59 @@ func Apply(sch Schedule, stop chan interface{}, send chan []byte, errx chan erro
 }
 
 // Loop : this shall apply the schedule infinetly till the schedule is running fine
+// or till the schedule expires, when the loop exits on its own
+// LoopContext is the one to use where the loop has to stop promptly, and be waited upon before send is closed
 func Loop(sch Schedule, cancel, interrupt chan interface{}, send chan []byte, errx chan error) {
+	LoopWithClock(sch, RealClock, cancel, interrupt, send, errx)
+}
+
+// LoopWithClock : same as Loop, but the schedule is applied on the clock given
+func LoopWithClock(sch Schedule, clk Clock, cancel, interrupt chan interface{}, send chan []byte, errx chan error) {
+	LoopWithEvents(sch, clk, cancel, interrupt, send, errx, nil)
+}
+
+// LoopWithEvents : same as LoopWithClock, and when the schedule expires an event is sent on events before the loop exits
+// if events is nil its just logged
+func LoopWithEvents(sch Schedule, clk Clock, cancel, interrupt chan interface{}, send chan []byte, errx chan error, events chan Event) {
 	stop := make(chan interface{})
 	defer close(stop)
 	for {
-		call, ok := Apply(sch, stop, send, errx)
+		if sch != nil && expiredAt(sch, clk.Now()) {
+			ev := Event{Kind: EventExpired, Schedule: fmt.Sprintf("%s", sch), At: clk.Now()}
+			if events != nil {
+				select {
+				case events <- ev:
+				case <-cancel:
+				case <-interrupt:
+				}
+			} else {
+				log.Infof("Loop: %s", ev)
+			}
+			return
+		}
+		call, ok := ApplyWithClock(sch, clk, stop, send, errx)
 		go call()
 		select {
 		case <-cancel:
+			return
 		case <-interrupt:
 			// Incase there's a signal interruption or from file change, the loop will have to quit its infinite nature
 			return
-		case <-ok:
+		case _, done := <-ok:
 			// this is when the schedule has done applying for one cycle
 			// will go back to applying the next schedule for the then current time
+			if done && completedRun(sch, clk.Now()) {
+				sch.AddRun()
+			}
 		}
 	}
 }
 
 // overlapsWith : is the function for basis of identifying the conflicts in any 2 schedules
 func overlapsWith(left, right Schedule) (bool, bool, bool, bool) {
+	if left.Wraps() || right.Wraps() {
+		return overlapsOnCircle(left, right)
+	}
 	var outside, inside, overlap, coincide bool
 	// Midpoints are distance of the half time since midnight for any schedule
 	mdpt1, mdpt2 := left.Midpoint(), right.Midpoint()
@@ -172,6 +284,43 @@ func overlapsWith(left, right Schedule) (bool, bool, bool, bool) {
 	return outside, inside, overlap, coincide
 }
 
+// arcOf : start and length in seconds of the part of the day the schedule is in effect, on a circular day
+func arcOf(sch Schedule) (int, int) {
+	lw, hg := sch.Triggers()
+	if sch.Wraps() {
+		return hg.At(), sch.Duration()
+	}
+	return lw.At(), hg.At() - lw.At()
+}
+
+// inArc : true if the second of the day is strictly inside the arc, the ends of the arc are not
+func inArc(start, length, t int) bool {
+	d := ((t-start)%86400 + 86400) % 86400
+	return d > 0 && d < length
+}
+
+// overlapsOnCircle : same as overlapsWith, but on a day that is circular so that schedules can wrap past midnight
+// 2 schedules overlap when either has an end inside the other and the other way round too, they coincide when they share an end without overlapping
+func overlapsOnCircle(left, right Schedule) (bool, bool, bool, bool) {
+	var outside, inside, overlap, coincide bool
+	ls, ll := arcOf(left)
+	rs, rl := arcOf(right)
+	le, re := (ls+ll)%86400, (rs+rl)%86400
+	rInL1, rInL2 := inArc(ls, ll, rs), inArc(ls, ll, re)
+	lInR1, lInR2 := inArc(rs, rl, ls), inArc(rs, rl, le)
+	switch {
+	case (rInL1 || rInL2) && (lInR1 || lInR2):
+		overlap = true
+	case ls == rs || ls == re || le == rs || le == re:
+		coincide = true
+	case (rInL1 && rInL2) || (lInR1 && lInR2):
+		inside = true
+	default:
+		outside = true
+	}
+	return outside, inside, overlap, coincide
+}
+
 // JSONRelayState : relaystate but in json format
 // ================================== Json Relay state is for file reads ============================
 // Making a relay state from a json file
@@ -180,29 +329,160 @@ type JSONRelayState struct {
 	OFF     string   `json:"off" bson:"off"`
 	IDs     []string `json:"ids" bson:"ids"`
 	Primary bool     `json:"primary" bson:"primary"`
+	// IANA time zone name, the ON/OFF times are wall clock times in this zone
+	// when empty the zone of the schedule file applies, else the local zone of the host
+	TZ string `json:"tz,omitempty" bson:"tz,omitempty"`
+	// Days : days of the week the schedule is in effect, as MON, TUE or MON-FRI, empty is everyday
+	Days []string `json:"days,omitempty" bson:"days,omitempty"`
+	// From, Until : dates as 2006-01-02 between which the schedule is in effect, both inclusive, empty leaves the range open
+	From  string `json:"from,omitempty" bson:"from,omitempty"`
+	Until string `json:"until,omitempty" bson:"until,omitempty"`
+	// Lat, Lon : place of the schedule, needed only when ON/OFF are relative to sunrise or sunset
+	// when not given, that of the schedule file applies
+	Lat *float64 `json:"lat,omitempty" bson:"lat,omitempty"`
+	Lon *float64 `json:"lon,omitempty" bson:"lon,omitempty"`
+	// Once, Runs, Expires : lifetime of the schedule - run for one cycle, for n cycles or till the time as RFC3339 or 2006-01-02 15:04
+	// schedules live forever otherwise
+	Once    bool   `json:"once,omitempty" bson:"once,omitempty"`
+	Runs    int    `json:"runs,omitempty" bson:"runs,omitempty"`
+	Expires string `json:"expires,omitempty" bson:"expires,omitempty"`
+	// Priority : of the schedules in effect on a relay the one with the highest priority wins
+	// 0 is PriorityBase, where patches win over the primary while they are in effect
+	Priority int `json:"priority,omitempty" bson:"priority,omitempty"`
+	// Steps : makes a sequence schedule, that sets relays step by step at the times given, ON, OFF and IDs are then not needed
+	Steps []JSONStep `json:"steps,omitempty" bson:"steps,omitempty"`
+	// Cycle : makes an interval schedule, that turns the relays ON and OFF for the durations given over and over between ON and OFF
+	Cycle *JSONCycle `json:"cycle,omitempty" bson:"cycle,omitempty"`
+	// Pulse : width of the pulse as 500ms, makes a pulse schedule that pulses the relays at ON everyday, there is no OFF then
+	Pulse string `json:"pulse,omitempty" bson:"pulse,omitempty"`
+	// Level : level the relays are set to at ON, for dimmers, fan speeds or valve positions upto MaxLevel, 0 is just ON
+	Level int `json:"level,omitempty" bson:"level,omitempty"`
+	// Ramp : duration as 30m over which the level fades in from ON and out from OFF, for patch schedules
+	Ramp string `json:"ramp,omitempty" bson:"ramp,omitempty"`
+	// Jitter, Seed : vacation mode, ON and OFF are shifted everyday by a random offset within jitter as 20m either way
+	// offsets are drawn from the seed, without which one is derived from the schedule
+	Jitter string `json:"jitter,omitempty" bson:"jitter,omitempty"`
+	Seed   int64  `json:"seed,omitempty" bson:"seed,omitempty"`
 }
 
 // ToSchedule : reads from json and pumps up a schedule
 // this saves you the trouble of making a schedule via code,
 // from a json file it can read up a relaystate and convert that to schedule
 func (jrs *JSONRelayState) ToSchedule() (Schedule, error) {
-	onTm, err := TimeStr(jrs.ON).ToElapsedTm()
-	if err != nil {
-		return nil, fmt.Errorf("Failed to read ON time for schedule")
+	if jrs.Level < 0 || jrs.Level > MaxLevel {
+		return nil, fmt.Errorf("Level %d for schedule is not within 0-%d", jrs.Level, MaxLevel)
 	}
-	offTm, err := TimeStr(jrs.OFF).ToElapsedTm()
-	if err != nil {
-		return nil, fmt.Errorf("Failed to read OFF time for schedule")
+	level := byte(1)
+	if jrs.Level > 0 {
+		level = byte(jrs.Level)
 	}
 	offs := []*RelayState{}
 	ons := []*RelayState{}
 	for _, id := range jrs.IDs {
 		offs = append(offs, &RelayState{byte(0), id})
-		ons = append(ons, &RelayState{byte(1), id})
+		ons = append(ons, &RelayState{level, id})
+	}
+	loc, err := LoadLocation(jrs.TZ)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read time zone for schedule: %s", err)
+	}
+	cal, err := NewCalendar(jrs.Days, jrs.From, jrs.Until)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read days for schedule: %s", err)
+	}
+	life, err := NewLifetime(jrs.Once, jrs.Runs, jrs.Expires, loc)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read lifetime for schedule: %s", err)
+	}
+	// each of these makes a different kind of schedule, together one would be silently dropped
+	kinds := []string{}
+	for kind, set := range map[string]bool{"steps": len(jrs.Steps) > 0, "pulse": jrs.Pulse != "", "cycle": jrs.Cycle != nil, "ramp": jrs.Ramp != "", "jitter": jrs.Jitter != ""} {
+		if set {
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(kinds) > 1 {
+		sort.Strings(kinds)
+		return nil, fmt.Errorf("Schedule can have only one of steps, pulse, cycle, ramp or jitter, not %s", strings.Join(kinds, " and "))
+	}
+	var sched Schedule
+	switch {
+	case len(jrs.Steps) > 0:
+		sched, err = jrs.sequence(loc)
+	case jrs.Pulse != "":
+		sched, err = jrs.pulse(loc)
+	case jrs.Cycle != nil:
+		sched, err = jrs.interval(ons, offs, loc)
+	case jrs.Ramp != "":
+		sched, err = jrs.ramp(ons, offs, loc)
+	case jrs.Jitter != "":
+		sched, err = jrs.jitter(ons, offs, loc)
+	default:
+		sched, err = jrs.pair(ons, offs, loc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if jrs.Priority != 0 {
+		sched = sched.WithPriority(jrs.Priority)
+	}
+	return sched.InLocation(loc).OnCalendar(cal).WithLifetime(life), nil
+
+}
+
+// pair : schedule from the ON and OFF triggers, primary or patch
+func (jrs *JSONRelayState) pair(ons, offs []*RelayState, loc *time.Location) (Schedule, error) {
+	on, off, err := jrs.triggers(ons, offs, loc)
+	if err != nil {
+		return nil, err
+	}
+	if jrs.Primary {
+		return NewSchedule(on, off, true)
+	}
+	return NewPatchSchedule(on, off)
+}
+
+// triggers : ON and OFF triggers for the schedule, either at clock times or on cron expressions
+func (jrs *JSONRelayState) triggers(ons, offs []*RelayState, loc *time.Location) (Trigger, Trigger, error) {
+	if IsCron(jrs.ON) || IsCron(jrs.OFF) {
+		if jrs.Primary {
+			return nil, nil, fmt.Errorf("Cron schedules can only be patch schedules, cannot be primary")
+		}
+		on, err := NewCronTrg(jrs.ON, ons...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to read ON cron for schedule: %s", err)
+		}
+		off, err := NewCronTrg(jrs.OFF, offs...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to read OFF cron for schedule: %s", err)
+		}
+		return on, off, nil
 	}
-	trg1, trg2 := NewTrg(offTm, offs...), NewTrg(onTm, ons...)
-	return NewSchedule(trg1, trg2, jrs.Primary)
+	on, err := jrs.clockTrigger(jrs.ON, ons, loc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read ON time for schedule: %s", err)
+	}
+	off, err := jrs.clockTrigger(jrs.OFF, offs, loc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read OFF time for schedule: %s", err)
+	}
+	return on, off, nil
+}
 
+// clockTrigger : trigger at a time of the day, which is either a clock time or relative to sunrise/sunset
+// times relative to the sun are resolved for today in the zone of the schedule, or the next day the sun rises or sets if it does not today
+func (jrs *JSONRelayState) clockTrigger(tm string, states []*RelayState, loc *time.Location) (Trigger, error) {
+	if IsSolar(tm) {
+		if jrs.Lat == nil || jrs.Lon == nil {
+			return nil, fmt.Errorf("%s needs the lat and lon of the schedule", tm)
+		}
+		return NewSolarTrg(tm, *jrs.Lat, *jrs.Lon, loc, states...)
+	}
+	secs, err := TimeStr(tm).ToElapsedTm()
+	if err != nil {
+		return nil, err
+	}
+	return NewTrg(secs, states...), nil
 }
 
 // SliceOfJSONRelayState : we are just encapsulating the slices to extend functions over it
@@ -211,34 +491,188 @@ type SliceOfJSONRelayState []JSONRelayState
 // From a SliceOfJSONRelayState to a slice of schedules, this not only converts but also marks the schedules with conflicts
 // Used when reading schedules from files or API payloads
 func (sofjrs SliceOfJSONRelayState) ToSchedules(scheds *[]Schedule) error {
+	result, err := sofjrs.toSchedules()
+	if err != nil {
+		return err
+	}
+	flagConflicts(result)
+	*scheds = result
+	return nil
+}
+
+// toSchedules : only converts, conflicts are not flagged
+func (sofjrs SliceOfJSONRelayState) toSchedules() ([]Schedule, error) {
 	result := []Schedule{}
 	// converting from json schedules to schedule object slice
 	for _, s := range sofjrs {
 		sched, err := s.ToSchedule()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		result = append(result, sched)
 	}
-	// flagging conflicts
-	for i, s := range result {
-		for _, ss := range result[i+1:] {
-			if s.ConflictsWith(ss) {
+	return result, nil
+}
+
+// flagConflicts : every schedule that conflicts with one before it in the slice gets a conflict, and the clash that explains it
+// schedules of different priorities do not conflict, the one with the higher priority just wins
+// pulses conflict with schedules that hold their relays at the time of the pulse, see pulseClash
+func flagConflicts(scheds []Schedule) {
+	for i, s := range scheds {
+		for _, ss := range scheds[i+1:] {
+			if s.Priority() == ss.Priority() && (s.ConflictsWith(ss) || pulseClash(s, ss)) {
 				ss.AddConflict()
+				ss.AddClash(newConflict(s, ss))
 			}
 		}
 	}
+}
+
+// ScheduleFile : contents of the json schedule file
+type ScheduleFile struct {
+	// TZ : IANA time zone for all the schedules in the file that do not have their own
+	TZ string `json:"tz,omitempty"`
+	// Lat, Lon : place for all the schedules in the file relative to sunrise/sunset that do not have their own
+	Lat       *float64              `json:"lat,omitempty"`
+	Lon       *float64              `json:"lon,omitempty"`
+	Schedules SliceOfJSONRelayState `json:"schedules"`
+	// Holidays : dates on which the schedules of their relays are suppressed, and substitutes if any run instead
+	Holidays []JSONHoliday `json:"holidays,omitempty"`
+	// ICal : path to an iCalendar file of more holidays, these apply to all the relays
+	ICal string `json:"ical,omitempty"`
+	// Interlocks : relays that may not be ON together, the schedules are previewed against these over a week when read, and the engine enforces them
+	Interlocks []JSONInterlock `json:"interlocks,omitempty"`
+	// Protections : limits on how often relays may switch, the schedules are previewed against these over a week when read, and the engine enforces them
+	Protections []JSONProtection `json:"protections,omitempty"`
+}
+
+// withDefaults : schedules with the zone and place of the file applied to those that have none
+func (sf *ScheduleFile) withDefaults(sojrs SliceOfJSONRelayState) SliceOfJSONRelayState {
+	result := SliceOfJSONRelayState{}
+	for _, jrs := range sojrs {
+		if jrs.TZ == "" {
+			jrs.TZ = sf.TZ
+		}
+		if jrs.Lat == nil && jrs.Lon == nil {
+			jrs.Lat, jrs.Lon = sf.Lat, sf.Lon
+		}
+		result = append(result, jrs)
+	}
+	return result
+}
+
+// ToSchedules : converts the schedules in the file, with the zone of the file applied to those that have none
+// Schedules do not run on holidays of their relays, while the substitute schedules of the holidays run only on those
+// The schedules are checked against the interlocks and protections over the week from today, see ToSchedulesAt
+func (sf *ScheduleFile) ToSchedules(scheds *[]Schedule) error {
+	return sf.ToSchedulesAt(scheds, time.Now())
+}
+
+// ToSchedulesAt : same as ToSchedules, but checks the schedules against the interlocks and protections over the week from the day of at, in the zone of the file
+// Schedules that conflict are not checked, they never run
+// Its only a preview of the week, transitions outside it are not checked, as of calendars that start later, holidays, lifetimes, cron days of the month or jitter
+// those are caught by the engine, that enforces the interlocks and protections on every transition
+func (sf *ScheduleFile) ToSchedulesAt(scheds *[]Schedule, at time.Time) error {
+	loc, err := LoadLocation(sf.TZ)
+	if err != nil {
+		return fmt.Errorf("Failed to read time zone for schedule file: %s", err)
+	}
+	holidays := Holidays{}
+	if sf.ICal != "" {
+		fromIcal, err := ReadICalendar(sf.ICal)
+		if err != nil {
+			return fmt.Errorf("Failed to read holidays from iCalendar: %s", err)
+		}
+		holidays = append(holidays, fromIcal...)
+	}
+	substitutes := []Schedule{}
+	for _, jh := range sf.Holidays {
+		h, err := jh.ToHoliday()
+		if err != nil {
+			return err
+		}
+		holidays = append(holidays, h)
+		subs, err := sf.withDefaults(jh.Schedules).toSchedules()
+		if err != nil {
+			return fmt.Errorf("Failed to read schedules for holiday %s: %s", h, err)
+		}
+		for _, sub := range subs {
+			cal := sub.Calendar()
+			cal.Only = Holidays{h}
+			substitutes = append(substitutes, sub.OnCalendar(cal))
+		}
+	}
+	result, err := sf.withDefaults(sf.Schedules).toSchedules()
+	if err != nil {
+		return err
+	}
+	for _, sched := range result {
+		lw, _ := sched.Triggers()
+		cal := sched.Calendar()
+		cal.Except = holidays.Covering(lw.RelayIDs())
+		sched.OnCalendar(cal)
+	}
+	result = append(result, substitutes...)
+	flagConflicts(result)
+	runnable := []Schedule{}
+	for _, sched := range result {
+		if sched.Conflicts() == 0 {
+			runnable = append(runnable, sched)
+		}
+	}
+	locks, err := sf.ToInterlocks()
+	if err != nil {
+		return err
+	}
+	// a week has every day of the week, but not every date, this is a preview and the engine enforces the rules at runtime
+	from := dateOf(at, loc)
+	if violations := CheckInterlocks(runnable, locks, from, from.AddDate(0, 0, 7)); len(violations) > 0 {
+		return fmt.Errorf("%d interlock violations, %s", len(violations), violations[0])
+	}
+	prots, err := sf.ToProtections()
+	if err != nil {
+		return err
+	}
+	if violations := CheckProtections(runnable, prots, from, from.AddDate(0, 0, 7)); len(violations) > 0 {
+		return fmt.Errorf("%d protection violations, %s", len(violations), violations[0])
+	}
 	*scheds = result
 	return nil
 }
 
+// ToInterlocks : interlocks in the file
+func (sf *ScheduleFile) ToInterlocks() ([]Interlock, error) {
+	result := []Interlock{}
+	for _, jil := range sf.Interlocks {
+		il, err := jil.ToInterlock()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, il)
+	}
+	return result, nil
+}
+
+// ToProtections : protections in the file
+func (sf *ScheduleFile) ToProtections() ([]Protection, error) {
+	result := []Protection{}
+	for _, jp := range sf.Protections {
+		p, err := jp.ToProtection()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
 // WriteScheduleFile : can overwrite the schedule file with new slice of json relay state
 func WriteScheduleFile(file string, sojrs SliceOfJSONRelayState) error {
-	contents := struct {
-		Schedules SliceOfJSONRelayState `json:"schedules"`
-	}{
-		Schedules: sojrs,
-	}
+	return WriteFile(file, &ScheduleFile{Schedules: sojrs})
+}
+
+// WriteFile : overwrites the schedule file with the contents given
+func WriteFile(file string, contents *ScheduleFile) error {
 	fileContent, err := json.MarshalIndent(contents, "", "	")
 	if err != nil {
 		return err
@@ -254,21 +688,35 @@ func WriteScheduleFile(file string, sojrs SliceOfJSONRelayState) error {
 // we have also added some conflict detection in here
 // Call this from the client function to get schedules with their conflict numbers
 func ReadScheduleFile(file string) ([]Schedule, error) {
+	return ReadScheduleFileAt(file, time.Now())
+}
+
+// ReadScheduleFileAt : same as ReadScheduleFile, with the schedules checked against the interlocks and protections over the week from the day of at
+func ReadScheduleFileAt(file string, at time.Time) ([]Schedule, error) {
+	_, scheds, err := readScheduleFile(file, at)
+	return scheds, err
+}
+
+// readScheduleFile : contents of the file along with the schedules, checked over the week from the day of at
+func readScheduleFile(file string, at time.Time) (*ScheduleFile, []Schedule, error) {
 	jsonFile, _ := os.Open(file)
 	// Reading bytes from the file and unmarshalling the same to struct values
 	bytes, err := ioutil.ReadAll(jsonFile)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	jsonFile.Close() // since this returns a closure, the call to this cannot be deferred
-	type conf struct {
-		Schedules SliceOfJSONRelayState `json:"schedules"`
+	c := ScheduleFile{}
+	if err := json.Unmarshal(bytes, &c); err != nil {
+		return nil, nil, fmt.Errorf("Failed to read schedule file %s: %s", file, err)
+	}
+	if c.ICal != "" && !filepath.IsAbs(c.ICal) {
+		// iCalendar file is relative to the schedule file
+		c.ICal = filepath.Join(filepath.Dir(file), c.ICal)
 	}
-	c := conf{}
-	json.Unmarshal(bytes, &c)
 	scheds := []Schedule{}
-	if err := c.Schedules.ToSchedules(&scheds); err != nil {
-		return nil, err
+	if err := c.ToSchedulesAt(&scheds, at); err != nil {
+		return nil, nil, err
 	}
-	return scheds, nil
+	return &c, scheds, nil
 }
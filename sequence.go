@@ -0,0 +1,172 @@
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// sequenceSchedule : patch schedule that steps thru an ordered list of triggers every day it is in effect, each step setting relays of its own
+// It opens with the first step and closes with the last one, and for conflict detection its thought of as a patch
+// from the first step to the last on all the relays of the sequence
+// Sequences do not wrap past midnight, the steps are in the order of the time of the day
+type sequenceSchedule struct {
+	*patchSchedule
+	// steps : as given, in the order of the time of the day
+	steps []Trigger
+	// cumulative : for every step, the states of all the relays set by the steps thus far
+	// transitions carry these, so that midway thru the sequence the state of every relay it has set is known
+	cumulative []Trigger
+}
+
+// NewSequenceSchedule : sequence of 2 or more steps at distinct times of the day, each with states of any of the relays
+// Steps can be clock or solar triggers, but not cron triggers
+func NewSequenceSchedule(steps ...Trigger) (Schedule, error) {
+	if len(steps) < 2 {
+		return nil, fmt.Errorf("sequence schedules need at least 2 steps, have %d", len(steps))
+	}
+	sorted := []Trigger{}
+	for _, step := range steps {
+		if step == nil {
+			return nil, fmt.Errorf("steps of a sequence cannot be nil")
+		}
+		if _, ok := step.(*cronTrg); ok {
+			return nil, fmt.Errorf("%s cron triggers cannot be steps of a sequence", step)
+		}
+		if len(step.RelayIDs()) == 0 {
+			return nil, fmt.Errorf("%s step of a sequence has to set at least one relay", step)
+		}
+		sorted = append(sorted, step)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].At() < sorted[j].At() })
+	ss := &sequenceSchedule{steps: sorted}
+	ids := []string{}
+	states := map[string]byte{}
+	for i, step := range sorted {
+		if i > 0 && step.At() == sorted[i-1].At() {
+			return nil, fmt.Errorf("%s-%s steps of a sequence cannot be at the same time", sorted[i-1], step)
+		}
+		for id, state := range step.States() {
+			if _, ok := states[id]; !ok {
+				ids = append(ids, id)
+			}
+			states[id] = state
+		}
+		sort.Strings(ids)
+		ss.cumulative = append(ss.cumulative, NewTrg(step.At(), relayStates(ids, states)...))
+	}
+	// the envelope is on all the relays, from the first step till the last
+	last := ss.cumulative[len(ss.cumulative)-1]
+	lower := NewTrg(sorted[0].At(), relayStates(ids, states)...)
+	ss.patchSchedule = &patchSchedule{primarySched: &primarySched{lower: lower, higher: last, loc: time.Local, cal: EveryDay}}
+	return ss.own(ss), nil
+}
+
+// relayStates : states of the relays in the order of ids
+func relayStates(ids []string, states map[string]byte) []*RelayState {
+	result := []*RelayState{}
+	for _, id := range ids {
+		result = append(result, &RelayState{states[id], id})
+	}
+	return result
+}
+
+func (ss *sequenceSchedule) String() string {
+	return fmt.Sprintf("%s - %s %v in %d steps ", TmStrFromUnixSecs(ss.lower.At()), TmStrFromUnixSecs(ss.higher.At()), ss.lower.RelayIDs(), len(ss.steps))
+}
+
+// Transitions : every step on every day the sequence is in effect, the last step closes it
+// On days when the clock shift gets the steps out of order, or a step relative to the sun does not fire, the sequence does not run at all
+func (ss *sequenceSchedule) Transitions(from, to time.Time) []Transition {
+	result := []Transition{}
+	forEachDate(from.Add(-24*time.Hour), to, ss.loc, func(date time.Time) {
+		if !ss.cal.Active(date) {
+			return
+		}
+		day := []Transition{}
+		for i, step := range ss.steps {
+			at, ok := triggerInstant(step, date, ss.loc)
+			if !ok || (i > 0 && at.Before(day[i-1].At)) {
+				return
+			}
+			day = append(day, Transition{At: at, Trigger: ss.cumulative[i]})
+		}
+		if !day[len(day)-1].At.After(day[0].At) {
+			return
+		}
+		day[len(day)-1].Closes = true
+		result = append(result, day...)
+	})
+	return inWindow(result, from, to)
+}
+
+// stepped : schedules that run thru many steps a day, sequences and those made of them
+type stepped interface {
+	stepList() []Trigger
+}
+
+// stepList : steps as given, in the order of the time of the day
+func (ss *sequenceSchedule) stepList() []Trigger {
+	return ss.steps
+}
+
+// completedRun : true if the cycle just applied on the schedule completes a run of it
+// a sequence is applied a step at a time, and its run is done only with the last step
+func completedRun(sch Schedule, now time.Time) bool {
+	if _, ok := sch.(stepped); !ok {
+		return true
+	}
+	trans, ok := lastTransition(sch, now)
+	return ok && trans.Closes
+}
+
+// JSONStep : one step of a sequence schedule, the relays turned ON and OFF at the time
+type JSONStep struct {
+	At  string   `json:"at" bson:"at"`
+	ON  []string `json:"on,omitempty" bson:"on,omitempty"`
+	OFF []string `json:"off,omitempty" bson:"off,omitempty"`
+	// Levels : relays set to levels at the time, as for dimmers
+	Levels map[string]int `json:"levels,omitempty" bson:"levels,omitempty"`
+}
+
+// sequence : sequence schedule from the steps, ON, OFF and IDs are of no consequence here
+func (jrs *JSONRelayState) sequence(loc *time.Location) (Schedule, error) {
+	if jrs.Primary {
+		return nil, fmt.Errorf("Sequence schedules can only be patch schedules, cannot be primary")
+	}
+	steps := []Trigger{}
+	for _, js := range jrs.Steps {
+		if IsCron(js.At) {
+			return nil, fmt.Errorf("Failed to read step %s for schedule: steps cannot be cron expressions", js.At)
+		}
+		states := []*RelayState{}
+		seen := map[string]bool{}
+		for _, id := range append(append([]string{}, js.ON...), js.OFF...) {
+			if seen[id] {
+				return nil, fmt.Errorf("%s is more than once in step %s", id, js.At)
+			}
+			seen[id] = true
+		}
+		for _, id := range js.ON {
+			states = append(states, &RelayState{byte(1), id})
+		}
+		for _, id := range js.OFF {
+			states = append(states, &RelayState{byte(0), id})
+		}
+		for id, lvl := range js.Levels {
+			if seen[id] {
+				return nil, fmt.Errorf("%s is more than once in step %s", id, js.At)
+			}
+			if lvl < 0 || lvl > MaxLevel {
+				return nil, fmt.Errorf("Level %d of %s at step %s is not within 0-%d", lvl, id, js.At, MaxLevel)
+			}
+			states = append(states, NewRelayLevel(id, byte(lvl)))
+		}
+		trg, err := jrs.clockTrigger(js.At, states, loc)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read step %s for schedule: %s", js.At, err)
+		}
+		steps = append(steps, trg)
+	}
+	return NewSequenceSchedule(steps...)
+}
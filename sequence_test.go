@@ -0,0 +1,77 @@
+package scheduling
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSequence : pump sequence that sets relays step by step, resolved and conflict checked as one patch
+func TestSequence(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "05:30 AM", IDs: []string{"IN1", "IN2"}, TZ: "UTC", Primary: true},
+		{TZ: "UTC", Steps: []JSONStep{
+			{At: "06:30 AM", OFF: []string{"IN1"}},
+			{At: "06:00 AM", ON: []string{"IN1"}},
+			{At: "06:05 AM", ON: []string{"IN2"}},
+			{At: "06:35 AM", OFF: []string{"IN2"}},
+		}},
+		{ON: "06:20 AM", OFF: "06:50 AM", IDs: []string{"IN2", "IN3"}, TZ: "UTC"},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	seq := scheds[1]
+	assert.Equal(t, "06:00 AM - 06:35 AM [IN1 IN2] in 4 steps ", fmt.Sprintf("%s", seq))
+	assert.Equal(t, 2100, seq.Duration())
+	assert.Equal(t, 0, seq.Conflicts(), "Sequence is within the primary, and does not conflict")
+
+	from := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	trans := seq.Transitions(from, from.Add(24*time.Hour))
+	assert.Equal(t, 4, len(trans))
+	assert.Equal(t, time.Date(2021, 8, 1, 6, 5, 0, 0, time.UTC), trans[1].At)
+	assert.Equal(t, map[string]byte{"IN1": 1, "IN2": 1}, trans[1].Trigger.States(), "Steps carry the states of all the relays set thus far")
+	assert.Equal(t, map[string]byte{"IN1": 0, "IN2": 1}, trans[2].Trigger.States())
+	assert.False(t, trans[2].Closes)
+	assert.True(t, trans[3].Closes)
+
+	nr, fr, _, post := seq.ToTaskAt(time.Date(2021, 8, 1, 6, 2, 0, 0, time.UTC))
+	assert.Equal(t, trans[0].Trigger, nr)
+	assert.Equal(t, trans[1].Trigger, fr)
+	assert.Equal(t, 180, post)
+
+	// the patch on IN2 and IN3 overlaps the sequence, and is left out
+	report := ConflictsIn(scheds)
+	assert.Equal(t, 1, len(report))
+	assert.Equal(t, ConflictPatches, report[0].Kind)
+	assert.True(t, seq == report[0].With)
+	assert.Equal(t, ComparableSlice{"IN2"}, report[0].Relays)
+
+	states := StateAt(scheds, time.Date(2021, 8, 1, 6, 32, 0, 0, time.UTC))
+	assert.Equal(t, byte(0), states["IN1"].State)
+	assert.Equal(t, byte(1), states["IN2"].State)
+	assert.True(t, seq == states["IN2"].Schedule)
+	states = StateAt(scheds, time.Date(2021, 8, 1, 7, 0, 0, 0, time.UTC))
+	assert.True(t, scheds[0] == states["IN2"].Schedule, "Sequence has closed")
+
+	// a run is done only when the last step is applied
+	assert.False(t, completedRun(seq, trans[2].At))
+	assert.True(t, completedRun(seq, trans[3].At))
+	assert.True(t, completedRun(scheds[0], trans[2].At))
+
+	bad := []JSONRelayState{
+		{TZ: "UTC", Steps: []JSONStep{{At: "06:00 AM", ON: []string{"IN1"}}}},
+		{TZ: "UTC", Steps: []JSONStep{{At: "06:00 AM", ON: []string{"IN1"}}, {At: "06:00 AM", OFF: []string{"IN1"}}}},
+		{TZ: "UTC", Steps: []JSONStep{{At: "06:00 AM", ON: []string{"IN1"}}, {At: "06:30 AM"}}},
+		{TZ: "UTC", Primary: true, Steps: []JSONStep{{At: "06:00 AM", ON: []string{"IN1"}}, {At: "06:30 AM", OFF: []string{"IN1"}}}},
+		{TZ: "UTC", Steps: []JSONStep{{At: "0 6 * * *", ON: []string{"IN1"}}, {At: "06:30 AM", OFF: []string{"IN1"}}}},
+		{TZ: "UTC", Steps: []JSONStep{{At: "05:00 AM", ON: []string{"IN1"}, OFF: []string{"IN1"}}, {At: "06:30 AM", OFF: []string{"IN1"}}}},
+		{TZ: "UTC", Steps: []JSONStep{{At: "05:00 AM", ON: []string{"IN1", "IN1"}}, {At: "06:30 AM", OFF: []string{"IN1"}}}},
+		{TZ: "UTC", Steps: []JSONStep{{At: "05:00 AM", ON: []string{"IN1"}, Levels: map[string]int{"IN1": 50}}, {At: "06:30 AM", OFF: []string{"IN1"}}}},
+	}
+	for _, b := range bad {
+		_, err := b.ToSchedule()
+		assert.NotNil(t, err, "Was expecting an error for %v", b.Steps)
+	}
+}
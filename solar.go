@@ -0,0 +1,174 @@
+package scheduling
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// Sunrise, Sunset : astronomical events a trigger can be relative to
+	Sunrise = "sunrise"
+	Sunset  = "sunset"
+	// zenith of the sun at rise and set, accounts for refraction and the size of the disc
+	solarZenith = 90.833
+)
+
+// IsSolar : tells apart sunrise/sunset times from clock times
+func IsSolar(expr string) bool {
+	expr = strings.ToLower(strings.TrimSpace(expr))
+	return strings.HasPrefix(expr, Sunrise) || strings.HasPrefix(expr, Sunset)
+}
+
+// ParseSolar : reads times like sunset, sunset+00:10 or sunrise-01:15 into the event and offset seconds from the event
+func ParseSolar(expr string) (string, int, error) {
+	expr = strings.ToLower(strings.TrimSpace(expr))
+	event := Sunrise
+	if strings.HasPrefix(expr, Sunset) {
+		event = Sunset
+	} else if !strings.HasPrefix(expr, Sunrise) {
+		return "", 0, fmt.Errorf("%q is not relative to sunrise or sunset", expr)
+	}
+	rest := strings.TrimSpace(expr[len(event):])
+	if rest == "" {
+		return event, 0, nil
+	}
+	sign := 1
+	switch rest[0] {
+	case '+':
+	case '-':
+		sign = -1
+	default:
+		return "", 0, fmt.Errorf("%q offset from %s should start with + or -", expr, event)
+	}
+	var hr, min int
+	if n, err := fmt.Sscanf(strings.TrimSpace(rest[1:]), "%d:%d", &hr, &min); err != nil || n != 2 || hr < 0 || min < 0 || min > 59 || hr > 12 {
+		return "", 0, fmt.Errorf("%q offset from %s should be HH:MM and not more than 12 hours", expr, event)
+	}
+	return event, sign * (hr*3600 + min*60), nil
+}
+
+// sunEvent : instant of sunrise or sunset on the calendar date (as given out by dateOf) in the zone
+// false when the sun does not rise or set at all on that date, as in the polar summers and winters
+// Worked out offline from the latitude and longitude, using the almanac algorithm that is accurate to a couple of minutes
+func sunEvent(date time.Time, lat, lon float64, rising bool, loc *time.Location) (time.Time, bool) {
+	rad, deg := math.Pi/180, 180/math.Pi
+	norm := func(v, max float64) float64 {
+		v = math.Mod(v, max)
+		if v < 0 {
+			v += max
+		}
+		return v
+	}
+	n := float64(date.YearDay())
+	lngHour := lon / 15
+	t := n + ((18 - lngHour) / 24)
+	if rising {
+		t = n + ((6 - lngHour) / 24)
+	}
+	// mean anomaly and true longitude of the sun
+	m := (0.9856 * t) - 3.289
+	l := norm(m+(1.916*math.Sin(m*rad))+(0.020*math.Sin(2*m*rad))+282.634, 360)
+	// right ascension, in the same quadrant as the longitude
+	ra := norm(deg*math.Atan(0.91764*math.Tan(l*rad)), 360)
+	ra = (ra + (math.Floor(l/90)*90 - math.Floor(ra/90)*90)) / 15
+	// declination and the local hour angle
+	sinDec := 0.39782 * math.Sin(l*rad)
+	cosDec := math.Cos(math.Asin(sinDec))
+	cosH := (math.Cos(solarZenith*rad) - (sinDec * math.Sin(lat*rad))) / (cosDec * math.Cos(lat*rad))
+	if cosH > 1 || cosH < -1 {
+		return time.Time{}, false
+	}
+	h := deg * math.Acos(cosH)
+	if rising {
+		h = 360 - h
+	}
+	h = h / 15
+	ut := norm(h+ra-(0.06571*t)-6.622-lngHour, 24)
+	y, mon, d := date.Date()
+	result := time.Date(y, mon, d, 0, 0, 0, 0, time.UTC).Add(time.Duration(ut * float64(time.Hour))).Truncate(time.Second)
+	// the hours are in UTC, which could be a day apart from the date in the zone
+	if local := dateOf(result, loc); local.Before(date) {
+		result = result.Add(24 * time.Hour)
+	} else if local.After(date) {
+		result = result.Add(-24 * time.Hour)
+	}
+	return result.In(loc), true
+}
+
+// solarTrg : trigger that fires at an offset from sunrise or sunset, which is different for each day
+// At of a solar trigger is the second it fires at on the day it was made or last resolved for
+type solarTrg struct {
+	*rlyStateTrg
+	event    string
+	offset   int
+	lat, lon float64
+}
+
+// NewSolarTrg : trigger for relay states at sunrise or sunset with an offset as in sunset+00:10, for the place given
+// Till resolved for any other day, At is for today in the zone, nil for the local zone
+// if the sun does not rise or set today at the place, as in the polar summer or winter, At is for the next day it does
+// the trigger does not fire on the days in between, errors out only if the sun never rises or sets there in a year
+func NewSolarTrg(expr string, lat, lon float64, loc *time.Location, states ...*RelayState) (Trigger, error) {
+	event, offset, err := ParseSolar(expr)
+	if err != nil {
+		return nil, err
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return nil, fmt.Errorf("%f,%f is not a valid latitude and longitude", lat, lon)
+	}
+	st := &solarTrg{rlyStateTrg: NewTrg(0, states...).(*rlyStateTrg), event: event, offset: offset, lat: lat, lon: lon}
+	if loc == nil {
+		loc = time.Local
+	}
+	today := dateOf(time.Now(), loc)
+	for date := today; date.Before(today.AddDate(1, 0, 1)); date = date.AddDate(0, 0, 1) {
+		if st.ResolveOn(date, loc) == nil {
+			return st, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s in a year at %f,%f", event, lat, lon)
+}
+
+// ResolveOn : sets At of the trigger to the second it fires at on the date of the time given in the zone
+// when the sun does not rise or set on that date, At is left as is and its an error
+func (st *solarTrg) ResolveOn(t time.Time, loc *time.Location) error {
+	date := dateOf(t, loc)
+	at, ok := st.instantOn(date, loc)
+	if !ok {
+		return fmt.Errorf("no %s on %s at %f,%f", st.event, date.Format(dateFormat), st.lat, st.lon)
+	}
+	st.at = ElapsedSeconds(at)
+	return nil
+}
+
+// instantOn : when the trigger fires on the calendar date in the zone
+func (st *solarTrg) instantOn(date time.Time, loc *time.Location) (time.Time, bool) {
+	at, ok := sunEvent(date, st.lat, st.lon, st.event == Sunrise, loc)
+	if !ok {
+		return at, false
+	}
+	return at.Add(time.Duration(st.offset) * time.Second), true
+}
+
+func (st *solarTrg) String() string {
+	offset := ""
+	if st.offset != 0 {
+		sign, secs := "+", st.offset
+		if secs < 0 {
+			sign, secs = "-", -secs
+		}
+		offset = fmt.Sprintf("%s%02d:%02d", sign, secs/3600, (secs%3600)/60)
+	}
+	return fmt.Sprintf("%s%s(%s), %v", st.event, offset, TmStrFromUnixSecs(st.at), st.RelayIDs())
+}
+
+// triggerInstant : instant on the calendar date in the zone at which the trigger fires
+// false if it does not fire on that date, as for sunset in the polar summer
+func triggerInstant(trg Trigger, date time.Time, loc *time.Location) (time.Time, bool) {
+	if st, ok := trg.(*solarTrg); ok {
+		return st.instantOn(date, loc)
+	}
+	return wallClock(date, trg.At(), loc), true
+}
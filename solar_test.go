@@ -0,0 +1,88 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSunEvents : sunrise and sunset worked out offline, within a few minutes of the almanac
+func TestSunEvents(t *testing.T) {
+	ist, _ := time.LoadLocation("Asia/Kolkata")
+	pst, _ := time.LoadLocation("America/Los_Angeles")
+	near := func(expected, actual time.Time) {
+		diff := expected.Sub(actual)
+		assert.True(t, diff < 3*time.Minute && diff > -3*time.Minute, "expected %s, got %s", expected, actual)
+	}
+	solstice := time.Date(2021, 6, 21, 0, 0, 0, 0, time.UTC)
+	// New Delhi
+	rise, ok := sunEvent(solstice, 28.6139, 77.2090, true, ist)
+	assert.True(t, ok)
+	near(time.Date(2021, 6, 21, 5, 24, 0, 0, ist), rise)
+	set, _ := sunEvent(solstice, 28.6139, 77.2090, false, ist)
+	near(time.Date(2021, 6, 21, 19, 22, 0, 0, ist), set)
+	// San Francisco, where sunset in UTC falls on the next day
+	set, _ = sunEvent(solstice, 37.7749, -122.4194, false, pst)
+	near(time.Date(2021, 6, 21, 20, 35, 0, 0, pst), set)
+	// Tromso has no sunset in the summer
+	_, ok = sunEvent(solstice, 69.6492, 18.9553, false, time.UTC)
+	assert.False(t, ok)
+
+	event, offset, err := ParseSolar("Sunset-01:15")
+	assert.Nil(t, err)
+	assert.Equal(t, Sunset, event)
+	assert.Equal(t, -4500, offset)
+	for _, bad := range []string{"sunset+10", "sunrise*00:10", "noon+00:10", "sunset+13:00"} {
+		_, _, err := ParseSolar(bad)
+		assert.NotNil(t, err, "Was expecting %q to be invalid", bad)
+	}
+}
+
+// TestSolarSchedules : trigger seconds that move with the seasons
+func TestSolarSchedules(t *testing.T) {
+	lat, lon := 28.6139, 77.2090
+	sf := ScheduleFile{
+		TZ:  "Asia/Kolkata",
+		Lat: &lat, Lon: &lon,
+		Schedules: SliceOfJSONRelayState{
+			{ON: "sunset+00:10", OFF: "sunrise-00:15", IDs: []string{"IN1"}, Primary: true},
+		},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, sf.ToSchedules(&scheds))
+	ist := scheds[0].Location()
+	summer := scheds[0].Transitions(time.Date(2021, 6, 21, 0, 0, 0, 0, ist), time.Date(2021, 6, 22, 0, 0, 0, 0, ist))
+	winter := scheds[0].Transitions(time.Date(2021, 12, 21, 0, 0, 0, 0, ist), time.Date(2021, 12, 22, 0, 0, 0, 0, ist))
+	assert.Equal(t, 2, len(summer))
+	assert.Equal(t, 2, len(winter))
+	// lights go OFF later and ON earlier in the winter
+	assert.True(t, ElapsedSeconds(winter[0].At) > ElapsedSeconds(summer[0].At)+3600)
+	assert.True(t, ElapsedSeconds(winter[1].At) < ElapsedSeconds(summer[1].At)+3600)
+	// 10 minutes past the sunset
+	set, _ := sunEvent(time.Date(2021, 6, 21, 0, 0, 0, 0, time.UTC), lat, lon, false, ist)
+	assert.Equal(t, set.Add(10*time.Minute), summer[1].At)
+
+	nr, _, _, post := scheds[0].ToTaskAt(time.Date(2021, 6, 21, 21, 0, 0, 0, ist))
+	assert.Equal(t, summer[1].Trigger, nr, "Lights should be ON after the sunset")
+	rise, _ := sunEvent(time.Date(2021, 6, 22, 0, 0, 0, 0, time.UTC), lat, lon, true, ist)
+	assert.Equal(t, ceilSeconds(rise.Add(-15*time.Minute).Sub(time.Date(2021, 6, 21, 21, 0, 0, 0, ist))), post)
+
+	// Tromso, no sunset to resolve the trigger on in the summer
+	st := &solarTrg{rlyStateTrg: NewTrg(0).(*rlyStateTrg), event: Sunset, lat: 69.6492, lon: 18.9553}
+	assert.NotNil(t, st.ResolveOn(time.Date(2021, 6, 21, 12, 0, 0, 0, time.UTC), time.UTC))
+	assert.Equal(t, 0, st.At(), "At is left as is when the sun does not set")
+	assert.Nil(t, st.ResolveOn(time.Date(2021, 9, 21, 12, 0, 0, 0, time.UTC), time.UTC))
+
+	// near the pole, read on any day of the year though the sun sets only on a few days around the equinoxes
+	polar, south := 89.5, 0.0
+	pf := ScheduleFile{TZ: "UTC", Lat: &polar, Lon: &south, Schedules: SliceOfJSONRelayState{
+		{ON: "sunset", OFF: "sunrise", IDs: []string{"IN1"}, Primary: true},
+	}}
+	polarScheds := []Schedule{}
+	assert.Nil(t, pf.ToSchedules(&polarScheds), "Schedules at a polar site are read whatever the day")
+	assert.Equal(t, 0, len(polarScheds[0].Transitions(time.Date(2021, 6, 21, 0, 0, 0, 0, time.UTC), time.Date(2021, 6, 22, 0, 0, 0, 0, time.UTC))), "No sunrise or sunset to fire on")
+
+	sf.Lat, sf.Lon = nil, nil
+	assert.NotNil(t, sf.ToSchedules(&scheds), "Was expecting an error for sunset without a place")
+}
@@ -3,47 +3,98 @@ package scheduling
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
+	// Controllers are often shipped with minimal images that have no zoneinfo on disk
+	_ "time/tzdata"
 )
 
-const (
-	// I tried to change PM to AM in the format, and then it fails to read PM. but when PM in format, it reads both
-	// https://stackoverflow.com/questions/44924628/golang-time-parse-1122-pm-something-that-i-can-do-math-with
-	format = "03:04 PM"
-	mdNt   = "12:00 AM"
-)
-
-// TimeStr : custom definition of time as string, indicated of the format above
+// TimeStr : custom definition of time as string, clock time of the day either as 12 hour 03:04 PM, 03:04:05 PM
+// or 24 hour 15:04, 15:04:05
 type TimeStr string
 
-// ToElapsedTm : just converts the string time to
+// ToElapsedTm : just converts the string time to seconds elapsed since midnight
+// errors describe which part of the time is out of range
 func (ts TimeStr) ToElapsedTm() (int, error) {
-	mdntTm, _ := time.Parse(format, mdNt) // getting the midnight time
-	tm, err := time.Parse(format, string(ts))
-	if err != nil {
-		return -1, err
+	s := strings.ToUpper(strings.TrimSpace(string(ts)))
+	ampm := ""
+	if strings.HasSuffix(s, "AM") || strings.HasSuffix(s, "PM") {
+		ampm = s[len(s)-2:]
+		s = strings.TrimSpace(s[:len(s)-2])
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return -1, fmt.Errorf("%q is not a time, expected as 03:04 PM, 03:04:05 PM, 15:04 or 15:04:05", ts)
+	}
+	nums := []int{0, 0, 0}
+	for i, part := range parts {
+		if len(part) == 0 || len(part) > 2 {
+			return -1, fmt.Errorf("%q is not a time, each part should be 1 or 2 digits", ts)
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return -1, fmt.Errorf("%q is not a time, %q is not a number", ts, part)
+		}
+		nums[i] = n
 	}
-	elapsed := tm.Sub(mdntTm).Seconds()
-	return int(elapsed), nil
+	hr, min, sec := nums[0], nums[1], nums[2]
+	if ampm != "" {
+		if hr > 12 {
+			return -1, fmt.Errorf("%q hour %d is out of range 0-12 for a 12 hour clock", ts, hr)
+		}
+		// 12 AM is midnight while 12 PM is noon, hour 0 reads the same as 12 as files written earlier have 00:30 PM for half past noon
+		hr = hr % 12
+		if ampm == "PM" {
+			hr += 12
+		}
+	} else if hr > 23 {
+		return -1, fmt.Errorf("%q hour %d is out of range 0-23", ts, hr)
+	}
+	if min > 59 {
+		return -1, fmt.Errorf("%q minutes %d is out of range 0-59", ts, min)
+	}
+	if sec > 59 {
+		return -1, fmt.Errorf("%q seconds %d is out of range 0-59", ts, sec)
+	}
+	return (hr * 3600) + (min * 60) + sec, nil
 }
 
 // TmStrFromUnixSecs : for the unix seconds given this can convert that into TimeStr
-// this application uses specific format of clock so that its compatible to PArsing of time
+// this application uses the 12 hour clock, seconds are shown only when not zero so that reading it back gives the same seconds
 func TmStrFromUnixSecs(elapsed int) TimeStr {
+	elapsed = ((elapsed % 86400) + 86400) % 86400
 	hr, rem := elapsed/3600, elapsed%3600
-	min := rem / 60
-	// fmt.Printf("%d %d\n", hr, min)
+	min, sec := rem/60, rem%60
 	ampm := "AM"
-	if hr >= 12 { // noon 12 is 12:01, while midnight 12 is 00:01
-		hr = hr - 12
+	if hr >= 12 {
 		ampm = "PM"
 	}
+	if hr = hr % 12; hr == 0 { // noon is 12:00 PM, while midnight is 12:00 AM
+		hr = 12
+	}
+	if sec != 0 {
+		return TimeStr(fmt.Sprintf("%02d:%02d:%02d %s", hr, min, sec, ampm))
+	}
 	return TimeStr(fmt.Sprintf("%02d:%02d %s", hr, min, ampm))
 }
 
 // ElapsedSecondsNow : this can for any given day, calculate the seconds that have elapsed since midnight
 func ElapsedSecondsNow() int {
-	hr, min, sec := time.Now().Clock()
+	return ElapsedSeconds(time.Now())
+}
+
+// LoadLocation : time zone from its IANA name, empty name is the local zone of the host
+func LoadLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(tz)
+}
+
+// ElapsedSeconds : seconds elapsed since midnight for the time given
+// for any other zone than that of t, pass t.In(loc)
+func ElapsedSeconds(t time.Time) int {
+	hr, min, sec := t.Clock()
 	return (hr * 3600) + (min * 60) + sec
 }
 
@@ -1,7 +1,55 @@
 package scheduling
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func TestDisplayTime(t *testing.T) {
 	t.Log(DisplayDateNow())
 }
+
+// TestTimeStr : 12 and 24 hour clock times, with and without seconds
+func TestTimeStr(t *testing.T) {
+	valid := map[TimeStr]int{
+		"06:30 PM":    18*3600 + 1800,
+		"6:30 pm":     18*3600 + 1800,
+		"12:00 AM":    0,
+		"12:15 PM":    12*3600 + 900,
+		"11:59:59 PM": 86399,
+		"18:30":       18*3600 + 1800,
+		"00:00:01":    1,
+		"23:59:59":    86399,
+		// as written by earlier versions for the hour past noon and midnight
+		"00:30 PM": 12*3600 + 1800,
+		"00:30 AM": 1800,
+	}
+	for ts, secs := range valid {
+		actual, err := ts.ToElapsedTm()
+		assert.Nil(t, err, "Unexpected error reading %s", ts)
+		assert.Equal(t, secs, actual, "Seconds since midnight for %s", ts)
+	}
+	invalid := []TimeStr{"24:00", "13:00 PM", "12:60", "12:30:60", "12", "12:30:00:00", "ab:30", "123:30", "-1:30"}
+	for _, ts := range invalid {
+		_, err := ts.ToElapsedTm()
+		assert.NotNil(t, err, "Was expecting an error reading %s", ts)
+	}
+	assert.Equal(t, TimeStr("12:30 PM"), TmStrFromUnixSecs(12*3600+1800), "Noon should read as 12 PM")
+	assert.Equal(t, TimeStr("12:00 AM"), TmStrFromUnixSecs(0), "Midnight should read as 12 AM")
+	assert.Equal(t, TimeStr("06:30:15 PM"), TmStrFromUnixSecs(18*3600+1815))
+	// schedule files written by earlier versions still load
+	jrs := SliceOfJSONRelayState{{ON: "00:30 PM", OFF: "00:45 PM", IDs: []string{"IN1"}}}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	lw, hg := scheds[0].Triggers()
+	assert.Equal(t, 12*3600+1800, lw.At())
+	assert.Equal(t, 12*3600+2700, hg.At())
+	// every second of the day reads back the same
+	for secs := 0; secs < 86400; secs++ {
+		back, err := TmStrFromUnixSecs(secs).ToElapsedTm()
+		if err != nil || back != secs {
+			t.Fatalf("%d round tripped to %s and back to %d - %v", secs, TmStrFromUnixSecs(secs), back, err)
+		}
+	}
+}
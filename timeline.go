@@ -0,0 +1,150 @@
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TimelineEvent : change in the state of a relay, and the schedule that caused it
+type TimelineEvent struct {
+	At       time.Time `json:"at"`
+	Relay    string    `json:"relay"`
+	State    byte      `json:"state"`
+	Schedule string    `json:"schedule"`
+	// Initial : state the relay is already in at the start of the timeline, At is then the start and not when it was set
+	Initial bool `json:"initial,omitempty"`
+	// Overrides : schedules in effect on the relay that the one causing the change wins over
+	Overrides []string `json:"overrides,omitempty"`
+}
+
+func (te TimelineEvent) String() string {
+	return fmt.Sprintf("%s %s=%d by %s", te.At.Format(time.RFC3339), te.Relay, te.State, te.Schedule)
+}
+
+// OverridePeriod : when a patch is overriding other schedules on a relay
+type OverridePeriod struct {
+	Relay     string    `json:"relay"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Schedule  string    `json:"schedule"`
+	Overrides []string  `json:"overrides"`
+}
+
+// Timeline : all the changes in the state of the relays over a window of time, in order
+type Timeline struct {
+	From      time.Time        `json:"from"`
+	To        time.Time        `json:"to"`
+	Events    []TimelineEvent  `json:"events"`
+	Overrides []OverridePeriod `json:"overrides"`
+}
+
+// ForRelay : timeline of just the one relay
+func (tl Timeline) ForRelay(id string) Timeline {
+	result := Timeline{From: tl.From, To: tl.To, Events: []TimelineEvent{}, Overrides: []OverridePeriod{}}
+	for _, ev := range tl.Events {
+		if ev.Relay == id {
+			result.Events = append(result.Events, ev)
+		}
+	}
+	for _, op := range tl.Overrides {
+		if op.Relay == id {
+			result.Overrides = append(result.Overrides, op)
+		}
+	}
+	return result
+}
+
+// CompileTimeline : previews the schedules over the window from (inclusive) till to (exclusive)
+// The state of each relay is resolved as in StateAt at every instant any of the schedules has a transition
+// and only the changes are on the timeline. A relay that no schedule is in effect on after a patch closes, is left in the state the patch closes with
+func CompileTimeline(scheds []Schedule, from, to time.Time) Timeline {
+	tl := Timeline{From: from, To: to, Events: []TimelineEvent{}, Overrides: []OverridePeriod{}}
+	instants := []time.Time{}
+	// keyed by the instant rather than the time, transitions are in the zones of their schedules
+	closing := map[int64][]Transition{}
+	for _, sch := range scheds {
+		if sch == nil || sch.Conflicts() > 0 {
+			continue
+		}
+		for _, trans := range sch.Transitions(from, to) {
+			if !trans.At.After(from) {
+				// at the very start of the window its already taken in as the initial state
+				continue
+			}
+			key := trans.At.UnixNano()
+			if _, ok := closing[key]; !ok {
+				instants = append(instants, trans.At)
+				closing[key] = []Transition{}
+			}
+			if trans.Closes {
+				closing[key] = append(closing[key], trans)
+			}
+		}
+	}
+	sort.Slice(instants, func(i, j int) bool { return instants[i].Before(instants[j]) })
+
+	prev := StateAt(scheds, from)
+	for _, id := range sortedRelays(prev) {
+		tl.Events = append(tl.Events, statusEvent(from, prev[id], true))
+	}
+	for _, at := range instants {
+		cur := StateAt(scheds, at)
+		for _, id := range sortedRelays(cur) {
+			status, was := cur[id], prev[id]
+			if was.Schedule == status.Schedule && was.State == status.State && was.Trigger == status.Trigger {
+				continue
+			}
+			tl.Events = append(tl.Events, statusEvent(at, status, false))
+		}
+		for _, id := range sortedRelays(prev) {
+			if _, ok := cur[id]; ok {
+				continue
+			}
+			// nothing in effect on the relay anymore, its left as the patch closing leaves it
+			for _, trans := range closing[at.UnixNano()] {
+				if state, ok := trans.Trigger.States()[id]; ok {
+					tl.Events = append(tl.Events, TimelineEvent{At: at, Relay: id, State: state, Schedule: fmt.Sprintf("%s", prev[id].Schedule)})
+					break
+				}
+			}
+		}
+		prev = cur
+	}
+	tl.Overrides = overridePeriods(tl.Events, to)
+	return tl
+}
+
+func statusEvent(at time.Time, status RelayStatus, initial bool) TimelineEvent {
+	ev := TimelineEvent{At: at, Relay: status.ID, State: status.State, Schedule: fmt.Sprintf("%s", status.Schedule), Initial: initial}
+	for _, sch := range status.Overrides {
+		ev.Overrides = append(ev.Overrides, fmt.Sprintf("%s", sch))
+	}
+	return ev
+}
+
+// overridePeriods : an override on a relay lasts from the event that has overrides till the next event on the relay, or the end of the timeline
+func overridePeriods(events []TimelineEvent, to time.Time) []OverridePeriod {
+	result := []OverridePeriod{}
+	open := map[string]int{}
+	for _, ev := range events {
+		if i, ok := open[ev.Relay]; ok {
+			result[i].To = ev.At
+			delete(open, ev.Relay)
+		}
+		if len(ev.Overrides) > 0 {
+			open[ev.Relay] = len(result)
+			result = append(result, OverridePeriod{Relay: ev.Relay, From: ev.At, To: to, Schedule: ev.Schedule, Overrides: ev.Overrides})
+		}
+	}
+	return result
+}
+
+func sortedRelays(states map[string]RelayStatus) []string {
+	result := []string{}
+	for id := range states {
+		result = append(result, id)
+	}
+	sort.Strings(result)
+	return result
+}
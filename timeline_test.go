@@ -0,0 +1,68 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCompileTimeline : changes of all the relays over a day, with the patch overriding the primary
+func TestCompileTimeline(t *testing.T) {
+	jrs := SliceOfJSONRelayState{
+		{ON: "06:30 PM", OFF: "06:30 AM", IDs: []string{"IN1", "IN2"}, TZ: "UTC", Primary: true},
+		{ON: "05:30 PM", OFF: "06:25 PM", IDs: []string{"IN1"}, TZ: "UTC"},
+		{ON: "07:30 PM", OFF: "08:30 PM", IDs: []string{"IN3"}, TZ: "UTC"},
+	}
+	scheds := []Schedule{}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	from := time.Date(2021, 8, 1, 17, 0, 0, 0, time.UTC)
+	tl := CompileTimeline(scheds, from, from.Add(24*time.Hour))
+
+	got := []string{}
+	for _, ev := range tl.Events {
+		got = append(got, ev.String())
+	}
+	primary, patch, patch3 := fmt.Sprintf("%s", scheds[0]), fmt.Sprintf("%s", scheds[1]), fmt.Sprintf("%s", scheds[2])
+	assert.Equal(t, []string{
+		"2021-08-01T17:00:00Z IN1=0 by " + primary,
+		"2021-08-01T17:00:00Z IN2=0 by " + primary,
+		"2021-08-01T17:30:00Z IN1=1 by " + patch,
+		"2021-08-01T18:25:00Z IN1=0 by " + primary,
+		"2021-08-01T18:30:00Z IN1=1 by " + primary,
+		"2021-08-01T18:30:00Z IN2=1 by " + primary,
+		"2021-08-01T19:30:00Z IN3=1 by " + patch3,
+		"2021-08-01T20:30:00Z IN3=0 by " + patch3,
+		"2021-08-02T06:30:00Z IN1=0 by " + primary,
+		"2021-08-02T06:30:00Z IN2=0 by " + primary,
+	}, got)
+	assert.True(t, tl.Events[0].Initial)
+	assert.Equal(t, []string{primary}, tl.Events[2].Overrides)
+
+	assert.Equal(t, 1, len(tl.Overrides))
+	assert.Equal(t, "IN1", tl.Overrides[0].Relay)
+	assert.Equal(t, time.Date(2021, 8, 1, 17, 30, 0, 0, time.UTC), tl.Overrides[0].From)
+	assert.Equal(t, time.Date(2021, 8, 1, 18, 25, 0, 0, time.UTC), tl.Overrides[0].To)
+
+	in3 := tl.ForRelay("IN3")
+	assert.Equal(t, 2, len(in3.Events))
+	assert.Equal(t, 0, len(in3.Overrides))
+	byt, err := json.Marshal(in3)
+	assert.Nil(t, err)
+	t.Log(string(byt))
+
+	// the same instants in different zones are one, IN2 is let go of as IN1 is
+	jrs = SliceOfJSONRelayState{
+		{ON: "10:00 AM", OFF: "11:00 AM", IDs: []string{"IN1"}, TZ: "UTC"},
+		{ON: "03:30 PM", OFF: "04:30 PM", IDs: []string{"IN2"}, TZ: "Asia/Kolkata"},
+	}
+	assert.Nil(t, jrs.ToSchedules(&scheds))
+	tl = CompileTimeline(scheds, from.Add(-12*time.Hour), from)
+	assert.Equal(t, 4, len(tl.Events))
+	in2 := tl.ForRelay("IN2")
+	assert.Equal(t, 2, len(in2.Events))
+	assert.Equal(t, byte(0), in2.Events[1].State)
+	assert.True(t, in2.Events[1].At.Equal(time.Date(2021, 8, 1, 11, 0, 0, 0, time.UTC)))
+}
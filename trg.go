@@ -24,6 +24,8 @@ type Trigger interface {
 	Intersects(other Trigger, exact bool) bool
 	// Checks to see if the trigger is coincident on time
 	Coincides(other Trigger) bool
+	// States : state of each of the relays the trigger sets, by relay ID
+	States() map[string]byte
 }
 
 func (tr *rlyStateTrg) String() string {
@@ -80,13 +82,18 @@ func (tr *rlyStateTrg) HasRelayWithID(find string) bool {
 // MarshalJSON : overriding the default implementation of marshaling json
 // this can help us send thru TCP with much ease
 func (tr *rlyStateTrg) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tr.States())
+}
+
+// States : state of each of the relays the trigger sets, by relay ID
+func (tr *rlyStateTrg) States() map[string]byte {
 	mpResult := map[string]byte{}
 	for _, state := range tr.rs {
 		for k, v := range state.Status() {
 			mpResult[k] = v
 		}
 	}
-	return json.Marshal(mpResult)
+	return mpResult
 }
 
 // FlipAllRelays : Flips all relays contained within, composite function sugar coat